@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
+	"go.uber.org/zap"
+)
+
+// bootstrapCommand creates the first admin account, so the registry can run without the admin configured by flags.
+const bootstrapCommand = "bootstrap"
+
+// bootstrap creates an admin with the server's MongoDB settings and optionally an API key for it.
+// The password can be set by TOKEN_VERIFIER_ADMIN_PASSWORD to keep it out of the shell history.
+func bootstrap(args []string) int {
+	adminName := flag.String("adminName", "", "name of the admin to create")
+	adminPassword := flag.String("adminPassword", "", "password of the admin to create")
+	adminScopes := flag.String("adminScopes", registryservice.ScopeAll, "comma separated scopes of the admin to create")
+	createAPIKey := flag.Bool("createAPIKey", false, "also create an API key with the scopes of the admin")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+
+	logger, _ := zap.NewProduction()
+	defer logger.Sync() // flushes buffer, if any
+	log = logger.Sugar()
+
+	if err := loadConfig(); err != nil {
+		log.Error(err)
+		return 1
+	}
+	admin, err := registryservice.NewAdmin(*adminName, *adminPassword, strings.Split(*adminScopes, ","), bootstrapCommand)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	ctx := context.Background()
+	db, err := mongoDB(ctx)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer disconnectMongoDB(clientDB)
+	service := registryservice.NewService(db)
+
+	if err := service.SaveAdmin(ctx, admin); err != nil {
+		log.Error(errors.Wrap(err, "failed to save admin"))
+		return 1
+	}
+	log.Infof("Created admin %s with scopes %v", admin.Name, admin.Scopes)
+	if !*createAPIKey {
+		return 0
+	}
+
+	apiKey, key, err := registryservice.NewAPIKey(admin, admin.Scopes)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	if err := service.SaveAPIKey(ctx, apiKey); err != nil {
+		log.Error(errors.Wrap(err, "failed to save API key"))
+		return 1
+	}
+	// the key is printed only once, it is stored hashed
+	fmt.Println(key)
+	return 0
+}
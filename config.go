@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cockroachdb/errors"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix prefixes the environment variables that set flags, e.g. TOKEN_VERIFIER_NODE_URL sets nodeUrl.
+	envPrefix = "TOKEN_VERIFIER_"
+
+	defaultBasicAuthPassword = "secret"
+	defaultMongoDBPassword   = "password"
+)
+
+// loadConfig applies the config file and the environment to every flag that was not set on the command line,
+// so flags take precedence over environment variables, which take precedence over the config file.
+func loadConfig() error {
+	setOnCommandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	path := *configFile
+	if !setOnCommandLine["config"] {
+		if value, ok := os.LookupEnv(envName("config")); ok {
+			path = value
+		}
+	}
+	fileValues := make(map[string]string)
+	if path != "" {
+		var err error
+		if fileValues, err = readConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	for name := range fileValues {
+		if name == "config" || flag.Lookup(name) == nil {
+			return errors.Newf("unknown setting %q in config file %s", name, path)
+		}
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || setOnCommandLine[f.Name] || f.Name == "config" {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			err = errors.Wrapf(f.Value.Set(value), "invalid value of %s", envName(f.Name))
+			return
+		}
+		if value, ok := fileValues[f.Name]; ok {
+			err = errors.Wrapf(f.Value.Set(value), "invalid value of %s in config file %s", f.Name, path)
+		}
+	})
+	return err
+}
+
+// readConfigFile reads a flat YAML or JSON object whose keys are flag names.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, errors.Newf("config file %s must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, errors.Newf("setting %q in config file %s must be a scalar", name, path)
+		}
+		values[name] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+// envName returns the environment variable of a flag, e.g. TOKEN_VERIFIER_RATE_LIMIT_PER_IP_BURST for
+// rateLimitPerIPBurst. Runs of capitals are kept together, so mongoDBURI becomes TOKEN_VERIFIER_MONGO_DBURI.
+func envName(flagName string) string {
+	runes := []rune(flagName)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return envPrefix + b.String()
+}
+
+// validateConfig checks the settings before the server starts.
+func validateConfig() error {
+	if *mongoDBURI != "" {
+		if _, err := connstring.ParseAndValidate(*mongoDBURI); err != nil {
+			return errors.Wrap(err, "invalid mongoDBURI")
+		}
+	} else if *mongoDBHostAddr == "" {
+		return errors.New("either mongoDBURI or hostAddr must be set")
+	}
+	if *mongoDBDatabase == "" || strings.ContainsAny(*mongoDBDatabase, `/\. "$`) {
+		return errors.Newf("invalid mongoDBDatabase %q", *mongoDBDatabase)
+	}
+	if *httpBindAddr != "" || *httpsBindAddr == "" {
+		if _, _, err := net.SplitHostPort(*httpBindAddr); err != nil {
+			return errors.Wrap(err, "invalid httpBindAddr")
+		}
+	}
+	if *httpsBindAddr != "" {
+		if _, _, err := net.SplitHostPort(*httpsBindAddr); err != nil {
+			return errors.Wrap(err, "invalid httpsBindAddr")
+		}
+		if *tlsCertFile == "" || *tlsKeyFile == "" {
+			return errors.New("tlsCertFile and tlsKeyFile must be set if httpsBindAddr is set")
+		}
+		if _, ok := tlsVersions[*tlsMinVersion]; !ok {
+			return errors.Newf("invalid tlsMinVersion %q, must be 1.2 or 1.3", *tlsMinVersion)
+		}
+	}
+	if _, err := url.ParseRequestURI(*nodeUrl); err != nil {
+		return errors.Wrap(err, "invalid nodeUrl")
+	}
+	if *publicURL != "" {
+		u, err := url.Parse(*publicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Newf("invalid publicURL %q, must be an absolute http or https URL", *publicURL)
+		}
+	}
+	for name, value := range map[string]time.Duration{
+		"logoFetchTimeout":      *logoFetchTimeout,
+		"mongoDBStartupTimeout": *mongoDBStartupTimeout,
+		"shutdownTimeout":       *shutdownTimeout,
+		"tlsReloadInterval":     *tlsReloadInterval,
+		"snapshotInterval":      *snapshotInterval,
+		"reverifyInterval":      *reverifyInterval,
+		"networkSyncInterval":   *networkSyncInterval,
+		"eventPollInterval":     *eventPollInterval,
+		"eventRetention":        *eventRetention,
+		"webhookTimeout":        *webhookTimeout,
+		"webhookRetention":      *webhookRetention,
+	} {
+		if value <= 0 {
+			return errors.Newf("%s must be positive", name)
+		}
+	}
+
+	if *rateLimitPerIP < 0 || *rateLimitGlobal < 0 || *adminRateLimitPerIP <= 0 {
+		return errors.New("rate limits must not be negative and the admin rate limit must be positive")
+	}
+	for name, value := range map[string]int64{
+		"rateLimitPerIPBurst":        int64(*rateLimitPerIPBurst),
+		"rateLimitGlobalBurst":       int64(*rateLimitGlobalBurst),
+		"adminRateLimitPerIPBurst":   int64(*adminRateLimitPerIPBurst),
+		"maxBodySize":                *maxBodySize,
+		"maxConcurrentVerifications": int64(*maxConcurrentVerifications),
+		"maxConcurrentSupplyReads":   int64(*maxConcurrentSupplyReads),
+		"maxEventStreams":            int64(*maxEventStreams),
+		"reportRateLimitPerHour":     int64(*reportRateLimitPerHour),
+		"snapshotRetention":          int64(*snapshotRetention),
+		"webhookMaxAttempts":         int64(*webhookMaxAttempts),
+	} {
+		if value <= 0 {
+			return errors.Newf("%s must be positive", name)
+		}
+	}
+
+	// an empty password disables the admin account configured by flags
+	if *basicAuthPassword != "" && *basicAuthUser == "" {
+		return errors.New("basicAuthUser must be set if basicAuthPassword is set")
+	}
+	if *basicAuthPassword == defaultBasicAuthPassword {
+		if !*devMode {
+			return errors.New("refusing to run with the default admin credentials, set basicAuthPassword or enable devMode")
+		}
+		log.Warnf("Running with the default admin credentials in dev mode")
+	}
+	for _, origin := range splitList(*adminCORSAllowOrigins) {
+		if origin == "*" && !*devMode {
+			return errors.New("refusing to allow any origin on the admin routes, list them in adminCORSAllowOrigins or enable devMode")
+		}
+	}
+	if *mongoDBURI == "" && *mongoDBpassword == defaultMongoDBPassword {
+		if !*devMode {
+			return errors.New("refusing to connect to MongoDB with the default password, set password or mongoDBURI or enable devMode")
+		}
+		log.Warnf("Connecting to MongoDB with the default password in dev mode")
+	}
+	return nil
+}
+
+// splitList splits a comma separated setting into its trimmed, non-empty values.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
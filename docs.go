@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// docsPage renders the OpenAPI document with ReDoc.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Token Verifier Registry API</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <redoc spec-url="` + registryhttp.OpenAPIEndpoint + `"></redoc>
+  <script src="https://cdn.jsdelivr.net/npm/redoc@2.0.0/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// OpenAPIRequest returns the OpenAPI document of the API.
+func OpenAPIRequest(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, registryhttp.OpenAPISpec)
+}
+
+// DocsRequest returns the browsable API documentation.
+func DocsRequest(c echo.Context) error {
+	return c.HTML(http.StatusOK, docsPage)
+}
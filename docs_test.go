@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// groupCatchAllPrefix prefixes the handler names of the routes echo adds for group middleware.
+const groupCatchAllPrefix = "github.com/labstack/echo.(*Group).Use"
+
+// TestOpenAPISpec compares the operations of the OpenAPI document with the registered routes and fails if either
+// has one the other lacks, so the document can not silently drift from the API.
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(registryhttp.OpenAPISpec, &spec); err != nil {
+		t.Fatalf("failed to parse the OpenAPI document: %v", err)
+	}
+	documented := make(map[string]bool)
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range testServer(t).Routes() {
+		// the catch-all routes of groups only reject unknown paths
+		if strings.HasPrefix(route.Name, groupCatchAllPrefix) {
+			continue
+		}
+		registered[route.Method+" "+openAPIPath(route.Path)] = true
+	}
+
+	var undocumented, unregistered []string
+	for operation := range registered {
+		if !documented[operation] {
+			undocumented = append(undocumented, operation)
+		}
+	}
+	for operation := range documented {
+		if !registered[operation] {
+			unregistered = append(unregistered, operation)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unregistered)
+	for _, operation := range undocumented {
+		t.Errorf("route %s is not documented", operation)
+	}
+	for _, operation := range unregistered {
+		t.Errorf("documented operation %s is not registered", operation)
+	}
+}
+
+// openAPIPath converts an echo route path to an OpenAPI path, e.g. /tokens/:ID to /tokens/{ID}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -6,9 +6,15 @@ require (
 	github.com/capossele/swearfilter v0.0.0-20210531151032-ba59a907cc63
 	github.com/cockroachdb/errors v1.8.4
 	github.com/go-resty/resty/v2 v2.6.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/iotaledger/iota.go/v3 v3.0.0-20220530132039-ec319e60cc56
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.12.2
 	go.mongodb.org/mongo-driver v1.5.1
 	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
+)
+
+const (
+	// nodeHealthTimeout defines how long a node may take to report its status.
+	nodeHealthTimeout = 5 * time.Second
+)
+
+// LivenessRequest reports that the process is up and serving requests.
+func LivenessRequest(c echo.Context) error {
+	return c.JSON(http.StatusOK, &registryhttp.HealthResponse{Status: registryhttp.HealthStatusOK})
+}
+
+// ReadinessRequest returns a handler reporting whether MongoDB, which pingDB pings, and the node of every enabled
+// network are reachable and the nodes are synced. It answers 503 if any of them is not.
+func ReadinessRequest(pingDB func() error, verifier *registryservice.Verifier) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := &registryhttp.HealthResponse{
+			Status:       registryhttp.HealthStatusOK,
+			Dependencies: make(map[string]*registryhttp.DependencyHealth),
+		}
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		record := func(name string, health *registryhttp.DependencyHealth) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Dependencies[name] = health
+			if health.Status != registryhttp.HealthStatusOK {
+				report.Status = registryhttp.HealthStatusUnavailable
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			record("mongodb", dependencyHealth(start, pingDB()))
+		}()
+
+		for _, network := range registryservice.EnabledNetworks() {
+			wg.Add(1)
+			go func(network string) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(c.Request().Context(), nodeHealthTimeout)
+				defer cancel()
+				start := time.Now()
+				status, err := verifier.NodeStatus(ctx, network)
+				health := dependencyHealth(start, err)
+				if status != nil {
+					health.ConfirmedMilestoneIndex = status.ConfirmedMilestone.Index
+					health.LatestMilestoneIndex = status.LatestMilestone.Index
+				}
+				record("node:"+network, health)
+			}(network)
+		}
+		wg.Wait()
+
+		if report.Status != registryhttp.HealthStatusOK {
+			return c.JSON(http.StatusServiceUnavailable, report)
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+func dependencyHealth(start time.Time, err error) *registryhttp.DependencyHealth {
+	health := &registryhttp.DependencyHealth{
+		Status:    registryhttp.HealthStatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		health.Status = registryhttp.HealthStatusUnavailable
+		health.Error = err.Error()
+	}
+	return health
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
+)
+
+func TestReadinessRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		mongoErr   error
+		nodeStatus int
+		healthy    bool
+		wantStatus int
+		wantMongo  string
+		wantNode   string
+	}{
+		{name: "ready", nodeStatus: http.StatusOK, healthy: true, wantStatus: http.StatusOK, wantMongo: registryhttp.HealthStatusOK, wantNode: registryhttp.HealthStatusOK},
+		{name: "mongo down", mongoErr: errors.New("connection refused"), nodeStatus: http.StatusOK, healthy: true, wantStatus: http.StatusServiceUnavailable, wantMongo: registryhttp.HealthStatusUnavailable, wantNode: registryhttp.HealthStatusOK},
+		{name: "node down", nodeStatus: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantMongo: registryhttp.HealthStatusOK, wantNode: registryhttp.HealthStatusUnavailable},
+		{name: "node not synced", nodeStatus: http.StatusOK, wantStatus: http.StatusServiceUnavailable, wantMongo: registryhttp.HealthStatusOK, wantNode: registryhttp.HealthStatusUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.nodeStatus != http.StatusOK {
+					w.WriteHeader(test.nodeStatus)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status": map[string]interface{}{
+						"isHealthy":          test.healthy,
+						"latestMilestone":    map[string]interface{}{"index": 12},
+						"confirmedMilestone": map[string]interface{}{"index": 11},
+					},
+				})
+			}))
+			defer node.Close()
+
+			handler := ReadinessRequest(func() error { return test.mongoErr }, registryservice.NewVerifier(node.URL))
+			rec := httptest.NewRecorder()
+			if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/health/ready", nil), rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			report := &registryhttp.HealthResponse{}
+			if err := json.Unmarshal(rec.Body.Bytes(), report); err != nil {
+				t.Fatal(err)
+			}
+			if got := report.Dependencies["mongodb"]; got == nil || got.Status != test.wantMongo {
+				t.Errorf("mongodb health = %+v, want %s", got, test.wantMongo)
+			}
+			for _, network := range registryservice.EnabledNetworks() {
+				got := report.Dependencies["node:"+network]
+				if got == nil || got.Status != test.wantNode {
+					t.Errorf("node:%s health = %+v, want %s", network, got, test.wantNode)
+					continue
+				}
+				if test.nodeStatus == http.StatusOK && got.ConfirmedMilestoneIndex != 11 {
+					t.Errorf("node:%s confirmed milestone = %d, want 11", network, got.ConfirmedMilestoneIndex)
+				}
+			}
+		})
+	}
+}
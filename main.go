@@ -1,13 +1,16 @@
 package main
 
 import (
-	"crypto/subtle"
+	"context"
 	"flag"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo"
-	"github.com/labstack/echo/middleware"
+	"github.com/lzpap/token-verifier/pkg/registrycli"
 	"github.com/lzpap/token-verifier/pkg/registryservice"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
@@ -16,6 +19,10 @@ import (
 const (
 	// defaultMongoDBOpTimeout defines the default MongoDB operation timeout.
 	defaultMongoDBOpTimeout = 5 * time.Second
+	// mongoDBMinBackoff defines the delay before the first retry to connect to MongoDB on startup.
+	mongoDBMinBackoff = 1 * time.Second
+	// mongoDBMaxBackoff defines the maximum delay between retries to connect to MongoDB on startup.
+	mongoDBMaxBackoff = 30 * time.Second
 )
 
 var (
@@ -27,15 +34,65 @@ var (
 )
 
 func main() {
+	// the binary doubles as the registry CLI when invoked with a command
+	if len(os.Args) > 1 && registrycli.IsCommand(os.Args[1]) {
+		os.Exit(registrycli.Run(os.Args[1:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == bootstrapCommand {
+		os.Exit(bootstrap(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	logger, _ := zap.NewProduction()
 	defer logger.Sync() // flushes buffer, if any
 	log = logger.Sugar()
+	zap.ReplaceGlobals(logger)
+
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	// ctx is cancelled on SIGINT or SIGTERM, which starts the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	service := registryservice.NewService(mongoDB())
+	db, err := mongoDB(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	service := registryservice.NewService(db)
+	registryservice.RegisterTokenCountCollector(service)
+	// the networks admins enabled or disabled are stored, so they survive restarts and are shared by all instances
+	networks := registryservice.NewNetworkSync(service, *networkSyncInterval)
+	if err := networks.Load(ctx); err != nil {
+		log.Fatal(err)
+	}
+	runWorker(ctx, "network sync", networks.Run)
 	verifier := registryservice.NewVerifier(*nodeUrl)
-	httpHandler := registryservice.NewHTTPHandler(service, log, verifier)
+	var logoFetcher *registryservice.LogoFetcher
+	if *fetchLogos {
+		logoFetcher = registryservice.NewLogoFetcher(*logoFetchTimeout)
+	}
+	auditor := registryservice.NewAuditor(service)
+	events := registryservice.NewEventFeed(service, *eventPollInterval, *eventRetention, splitList(*corsAllowOrigins))
+	runWorker(ctx, "event feed", events.Run)
+	webhooks := registryservice.NewWebhookDispatcher(service, *webhookTimeout, *webhookMaxAttempts, *webhookRetention, *webhookAllowPrivateAddresses)
+	events.OnPublish(webhooks.Enqueue)
+	runWorker(ctx, "webhook dispatcher", webhooks.Run)
+	tokenLists := registryservice.NewTokenListPublisher(service)
+	events.OnPublish(tokenLists.Enqueue)
+	runWorker(ctx, "token list publisher", tokenLists.Run)
+	reverifier := registryservice.NewReverifier(service, service, verifier, events, *reverifyInterval)
+	runWorker(ctx, "reverifier", reverifier.Run)
+	httpHandler := registryservice.NewHTTPHandler(service, log, verifier, logoFetcher, auditor, events, service, *publicURL)
+	adminHandler := registryservice.NewAdminHTTPHandler(service, auditor)
+	snapshotHandler := registryservice.NewSnapshotHTTPHandler(service)
+	webhookHandler := registryservice.NewWebhookHTTPHandler(service, webhooks, auditor)
+	auth := registryservice.NewAuthenticator(service, *basicAuthUser, *basicAuthPassword).Middleware()
 
 	Server()
 
@@ -43,28 +100,51 @@ func main() {
 	server.HideBanner = true
 	server.HidePort = true
 
-	server.Group("/admin")
-	adminGroup := middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-		// Be careful to use constant time comparison to prevent timing attacks
-		if subtle.ConstantTimeCompare([]byte(username), []byte(*basicAuthUser)) == 1 &&
-			subtle.ConstantTimeCompare([]byte(password), []byte(*basicAuthPassword)) == 1 {
-			return true, nil
-		}
-		return false, nil
-	})
+	// public routes share the rate limits, only the registrations and validations query the node
+	rateLimiter := registryservice.NewRateLimiter(*rateLimitPerIP, *rateLimitPerIPBurst, *rateLimitGlobal, *rateLimitGlobalBurst, *trustProxyHeaders)
+	runWorker(ctx, "rate limiter", rateLimiter.Run)
+	// abuse reports have a limit of their own, as the text of each one is read by an admin
+	reportLimiter := registryservice.NewRateLimiter(float64(*reportRateLimitPerHour)/3600, *reportRateLimitPerHour, 0, 0, *trustProxyHeaders)
+	runWorker(ctx, "report rate limiter", reportLimiter.Run)
+	// every admin request checks credentials, which is costly with bcrypt, so each client is limited before it is authenticated
+	adminLimiter := registryservice.NewRateLimiter(*adminRateLimitPerIP, *adminRateLimitPerIPBurst, 0, 0, *trustProxyHeaders)
+	runWorker(ctx, "admin rate limiter", adminLimiter.Run)
 
-	server.GET("/", IndexRequest)
-	server.POST("/registries/:network/tokens", httpHandler.SaveToken)
-	server.GET("/registries/:network/tokens", httpHandler.LoadTokens)
-	server.GET("/registries/:network/tokens/:ID", httpHandler.LoadToken)
+	if *snapshotSigningKey != "" {
+		key, err := registryservice.LoadSigningKey(*snapshotSigningKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		snapshotter := registryservice.NewSnapshotter(service, key, *snapshotInterval, uint64(*snapshotRetention))
+		runWorker(ctx, "snapshotter", snapshotter.Run)
+	}
 
-	server.DELETE("/admin/:network/tokens/byID/:ID", httpHandler.DeleteTokensByID, adminGroup)
-	server.DELETE("/admin/:network/tokens/byName/:name", httpHandler.DeleteTokensByName, adminGroup)
-	server.POST("/admin/filters/:word", httpHandler.AddFilter, adminGroup)
-	server.DELETE("/admin/filters/:word", httpHandler.DeleteFilter, adminGroup)
-	server.GET("/admin/filters", httpHandler.LoadFilter, adminGroup)
+	routes := &serverRoutes{
+		public: &publicRoutes{
+			handler:       httpHandler,
+			snapshots:     snapshotHandler,
+			events:        events,
+			limited:       rateLimiter.Middleware(),
+			bodyLimit:     registryservice.BodyLimit(*maxBodySize),
+			verifications: registryservice.ConcurrencyLimit(registryservice.LimitVerifications, *maxConcurrentVerifications),
+			supplyReads:   registryservice.ConcurrencyLimit(registryservice.LimitSupplyReads, *maxConcurrentSupplyReads),
+			eventStreams:  registryservice.ConcurrencyLimit(registryservice.LimitEventStreams, *maxEventStreams),
+			reports:       reportLimiter.Middleware(),
+		},
+		verifier:     verifier,
+		admins:       adminHandler,
+		webhooks:     webhookHandler,
+		adminLimited: adminLimiter.Middleware(),
+		auth:         auth,
+	}
+	routes.register(server)
 
 	log.Infof("Starting server ...")
 
-	log.Fatal(server.Start(*httpBindAddr))
+	if err := startServer(ctx, stop); err != nil {
+		log.Fatal(err)
+	}
+
+	<-ctx.Done()
+	shutdown()
 }
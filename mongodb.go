@@ -2,29 +2,59 @@ package main
 
 import (
 	"context"
+	"net/url"
 	"time"
 
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func mongoDB() *mongo.Database {
+// mongoDB connects to MongoDB, retrying with exponential backoff until it succeeds, the startup timeout
+// expires or ctx is cancelled.
+func mongoDB(ctx context.Context) (*mongo.Database, error) {
+	var err error
 	dbOnce.Do(func() {
-		client, err := newMongoDB()
-		if err != nil {
-			log.Fatal(err)
-		}
-		clientDB = client
+		ctx, cancel := context.WithTimeout(ctx, *mongoDBStartupTimeout)
+		defer cancel()
+		clientDB, err = connectWithRetry(ctx, mongoDBMinBackoff, mongoDBMaxBackoff, newMongoDB)
 	})
-	return clientDB.Database("registry")
+	if err != nil {
+		return nil, err
+	}
+	return clientDB.Database(*mongoDBDatabase), nil
+}
+
+// connectWithRetry calls connect until it succeeds or ctx is done. It waits minBackoff before the first retry and
+// doubles the wait after every failed attempt up to maxBackoff.
+func connectWithRetry(ctx context.Context, minBackoff, maxBackoff time.Duration, connect func() (*mongo.Client, error)) (*mongo.Client, error) {
+	backoff := minBackoff
+	for attempt := 1; ; attempt++ {
+		client, err := connect()
+		if err == nil {
+			return client, nil
+		}
+		log.Warnf("MongoDB connection attempt %d failed, retrying in %s: %s", attempt, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(err, "giving up connecting to MongoDB after %d attempts", attempt)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
 }
 
 func newMongoDB() (*mongo.Client, error) {
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://" + *mongodbUsername + ":" + *mongoDBpassword + "@" + *mongoDBHostAddr))
+	client, err := mongo.NewClient(options.Client().
+		ApplyURI(mongoDBConnectionURI()).
+		SetMonitor(registryservice.MongoMonitor()))
 	if err != nil {
-		log.Fatalf("MongoDB NewClient failed: %s", err)
-		return nil, err
+		return nil, errors.Wrap(err, "MongoDB NewClient failed")
 	}
 
 	if err := connectMongoDB(client); err != nil {
@@ -32,12 +62,26 @@ func newMongoDB() (*mongo.Client, error) {
 	}
 
 	if err := pingMongoDB(client); err != nil {
+		disconnectMongoDB(client)
 		return nil, err
 	}
 
 	return client, nil
 }
 
+// mongoDBConnectionURI returns mongoDBURI if set, otherwise the URI assembled from username, password and hostAddr.
+func mongoDBConnectionURI() string {
+	if *mongoDBURI != "" {
+		return *mongoDBURI
+	}
+	uri := url.URL{
+		Scheme: "mongodb",
+		User:   url.UserPassword(*mongodbUsername, *mongoDBpassword),
+		Host:   *mongoDBHostAddr,
+	}
+	return uri.String()
+}
+
 func connectMongoDB(client *mongo.Client) error {
 	ctx, cancel := operationTimeout(defaultMongoDBOpTimeout)
 	defer cancel()
@@ -58,6 +102,14 @@ func pingMongoDB(client *mongo.Client) error {
 	return nil
 }
 
+func disconnectMongoDB(client *mongo.Client) {
+	ctx, cancel := operationTimeout(defaultMongoDBOpTimeout)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		log.Warnf("MongoDB disconnect failed: %s", err)
+	}
+}
+
 func operationTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), timeout)
 }
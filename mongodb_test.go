@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	const minBackoff, maxBackoff = 5 * time.Millisecond, 20 * time.Millisecond
+	tests := []struct {
+		name         string
+		failures     int
+		timeout      time.Duration
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "first attempt", failures: 0, timeout: time.Second, wantAttempts: 1},
+		{name: "after retries", failures: 4, timeout: time.Second, wantAttempts: 5},
+		{name: "gives up", failures: 1000, timeout: 60 * time.Millisecond, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+
+			var attempts []time.Time
+			client, err := connectWithRetry(ctx, minBackoff, maxBackoff, func() (*mongo.Client, error) {
+				attempts = append(attempts, time.Now())
+				if len(attempts) <= test.failures {
+					return nil, errors.New("connection refused")
+				}
+				return &mongo.Client{}, nil
+			})
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "giving up") {
+					t.Errorf("connectWithRetry() = %v, %v, want to give up", client, err)
+				}
+				if len(attempts) < 2 {
+					t.Errorf("connectWithRetry() gave up after %d attempts, want retries", len(attempts))
+				}
+			} else {
+				if err != nil || client == nil {
+					t.Fatalf("connectWithRetry() = %v, %v", client, err)
+				}
+				if len(attempts) != test.wantAttempts {
+					t.Errorf("connectWithRetry() made %d attempts, want %d", len(attempts), test.wantAttempts)
+				}
+			}
+
+			// the waits double from minBackoff up to maxBackoff
+			backoff := minBackoff
+			for i := 1; i < len(attempts); i++ {
+				if waited := attempts[i].Sub(attempts[i-1]); waited < backoff {
+					t.Errorf("waited %s before attempt %d, want at least %s", waited, i+1, backoff)
+				}
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+		})
+	}
+}
@@ -1,15 +1,69 @@
 package main
 
-import "flag"
+import (
+	"flag"
+	"time"
+)
 
 var (
+	configFile = flag.String("config", "", "path of a YAML or JSON config file, overridden by environment variables and flags")
+	devMode    = flag.Bool("devMode", false, "allow insecure defaults such as the default admin credentials")
+
+	mongoDBURI      = flag.String("mongoDBURI", "", "full mongoDB connection URI, overrides username, password and hostAddr")
+	mongoDBDatabase = flag.String("mongoDBDatabase", "registry", "mongoDB database name")
 	mongodbUsername = flag.String("username", "root", "mongoDB username")
 	mongoDBpassword = flag.String("password", "password", "mongoDB password")
 	mongoDBHostAddr = flag.String("hostAddr", "mongodb:27017", "mongoDB host address")
-	httpBindAddr    = flag.String("httpBindAddr", "0.0.0.0:80", "http server bind address")
+	httpBindAddr    = flag.String("httpBindAddr", "0.0.0.0:80", "http server bind address, empty disables HTTP if HTTPS is enabled")
+
+	httpsBindAddr     = flag.String("httpsBindAddr", "", "https server bind address, empty disables HTTPS")
+	tlsCertFile       = flag.String("tlsCertFile", "", "path of the PEM encoded TLS certificate chain")
+	tlsKeyFile        = flag.String("tlsKeyFile", "", "path of the PEM encoded TLS private key")
+	tlsMinVersion     = flag.String("tlsMinVersion", "1.2", "minimum TLS version, 1.2 or 1.3")
+	tlsReloadInterval = flag.Duration("tlsReloadInterval", time.Minute, "how often to check the TLS certificate and key files for changes")
+	httpRedirect      = flag.Bool("httpRedirect", true, "redirect HTTP requests to HTTPS if HTTPS is enabled")
+
+	mongoDBStartupTimeout = flag.Duration("mongoDBStartupTimeout", 2*time.Minute, "how long to retry connecting to mongoDB on startup")
+	shutdownTimeout       = flag.Duration("shutdownTimeout", 30*time.Second, "how long to wait for in-flight requests and background workers on shutdown")
+
+	nodeUrl   = flag.String("nodeUrl", "http://localhost:14265/", "node url")
+	publicURL = flag.String("publicURL", "", "URL clients reach the registry at, e.g. https://registry.example.com, used for the logo links of the token lists")
+
+	networkSyncInterval = flag.Duration("networkSyncInterval", 10*time.Second, "how often to apply the network settings changed on other instances")
+
+	fetchLogos       = flag.Bool("fetchLogos", false, "download and pin the logo at logoUrl on registration")
+	logoFetchTimeout = flag.Duration("logoFetchTimeout", 10*time.Second, "timeout of a logo download")
+
+	rateLimitPerIP             = flag.Float64("rateLimitPerIP", 2, "requests per second each client may send to the public routes, 0 disables the limit")
+	rateLimitPerIPBurst        = flag.Int("rateLimitPerIPBurst", 10, "requests a client may send at once to the public routes")
+	rateLimitGlobal            = flag.Float64("rateLimitGlobal", 100, "requests per second all clients may send to the public routes, 0 disables the limit")
+	rateLimitGlobalBurst       = flag.Int("rateLimitGlobalBurst", 200, "requests all clients may send at once to the public routes")
+	adminRateLimitPerIP        = flag.Float64("adminRateLimitPerIP", 1, "requests per second each client may send to the admin routes, which check credentials on every request")
+	adminRateLimitPerIPBurst   = flag.Int("adminRateLimitPerIPBurst", 20, "requests a client may send at once to the admin routes")
+	trustProxyHeaders          = flag.Bool("trustProxyHeaders", false, "take the client IP from X-Forwarded-For and X-Real-IP, enable only behind a reverse proxy")
+	maxBodySize                = flag.Int64("maxBodySize", 512*1024, "maximum size of public request bodies in bytes")
+	maxConcurrentVerifications = flag.Int("maxConcurrentVerifications", 16, "maximum number of registrations and validations verified at the same time")
+	maxConcurrentSupplyReads   = flag.Int("maxConcurrentSupplyReads", 64, "maximum number of API v2 token reads querying the supply from the node at the same time")
+	maxEventStreams            = flag.Int("maxEventStreams", 1000, "maximum number of SSE and WebSocket event streams open at the same time")
+	reportRateLimitPerHour     = flag.Int("reportRateLimitPerHour", 10, "abuse reports each client may send per hour")
+
+	reverifyInterval = flag.Duration("reverifyInterval", time.Hour, "how often to verify every registered token against the node again")
+
+	snapshotSigningKey = flag.String("snapshotSigningKey", "", "path of the PEM encoded Ed25519 private key snapshots are signed with, empty disables snapshots")
+	snapshotInterval   = flag.Duration("snapshotInterval", time.Hour, "how often to take a signed snapshot of every enabled network")
+	snapshotRetention  = flag.Int("snapshotRetention", 168, "how many snapshots to keep per network")
+
+	eventPollInterval = flag.Duration("eventPollInterval", time.Second, "how often to check for registry events published by other instances")
+	eventRetention    = flag.Duration("eventRetention", 7*24*time.Hour, "how long to keep registry events, so subscribers can resume after them")
+
+	webhookTimeout               = flag.Duration("webhookTimeout", 10*time.Second, "timeout of a webhook delivery attempt")
+	webhookMaxAttempts           = flag.Int("webhookMaxAttempts", 10, "how many times to attempt a webhook delivery before it fails")
+	webhookRetention             = flag.Duration("webhookRetention", 30*24*time.Hour, "how long to keep finished webhook deliveries in the delivery log")
+	webhookAllowPrivateAddresses = flag.Bool("webhookAllowPrivateAddresses", false, "allow webhooks at loopback and private network addresses")
 
-	nodeUrl = flag.String("nodeUrl", "http://localhost:14265/", "node url")
+	corsAllowOrigins      = flag.String("corsAllowOrigins", "*", "comma separated origins allowed to call the public routes from browsers")
+	adminCORSAllowOrigins = flag.String("adminCORSAllowOrigins", "", "comma separated origins allowed to call the admin routes from browsers, empty allows none")
 
 	basicAuthUser     = flag.String("basicAuthUser", "admin", "basic auth user")
-	basicAuthPassword = flag.String("basicAuthPassword", "secret", "basic auth password")
+	basicAuthPassword = flag.String("basicAuthPassword", "secret", "basic auth password of the admin with all scopes, empty disables it")
 )
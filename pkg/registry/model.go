@@ -2,6 +2,8 @@ package registry
 
 import (
 	"context"
+	"fmt"
+	"time"
 )
 
 // IRC30Token defines and IRC30 native token and its metadata to be stored into a mongoDB.
@@ -24,14 +26,368 @@ type IRC30Token struct {
 	Logo string `json:"logo" bson:"logo"`
 	// MaxSupply defines the possible maximum supply of the token.
 	MaxSupply string `json:"maxSupply" bson:"maxSupply"`
+	// LogoHash defines the sha256 hash of the logo pinned from LogoURL at registration, set by the registry.
+	LogoHash string `json:"logoHash,omitempty" bson:"logoHash,omitempty"`
+	// CreatedAt defines when the token was registered, set by the registry and exposed by API v2 only.
+	CreatedAt time.Time `json:"-" bson:"createdAt,omitempty"`
+	// UpdatedAt defines when the token was last changed, set by the registry and exposed by API v2 only.
+	UpdatedAt time.Time `json:"-" bson:"updatedAt,omitempty"`
+	// VerifiedAt defines when the token was last verified against the ledger, set by the registry and exposed by
+	// API v2 only.
+	VerifiedAt time.Time `json:"-" bson:"verifiedAt,omitempty"`
+	// Provenance defines how the token was registered, set by the registry and exposed by API v2 only.
+	Provenance *Provenance `json:"-" bson:"provenance,omitempty"`
+	// VerificationStatus defines the outcome of the last live verification against the ledger, empty if it matched
+	// ever since the registration. Set by the registry and exposed by API v2 only.
+	VerificationStatus string `json:"-" bson:"verificationStatus,omitempty"`
+	// Flag defines why an admin flagged the token after it was reported, nil if it is not flagged. Set by the
+	// registry and exposed by API v2 only.
+	Flag *TokenFlag `json:"-" bson:"flag,omitempty"`
+	// TrustLevel defines the trust level an admin assigned, which replaces the one derived from the checks. Set by
+	// the registry and exposed by API v2 only.
+	TrustLevel string `json:"-" bson:"trustLevel,omitempty"`
+}
+
+// TokenFlag defines the warning an admin attached to a reported token.
+type TokenFlag struct {
+	// Reason defines the report reason the token was flagged for.
+	Reason string `json:"reason" bson:"reason"`
+	// ReportID defines the report the token was flagged for.
+	ReportID string `json:"reportId" bson:"reportId"`
+	// FlaggedAt defines when the token was flagged.
+	FlaggedAt time.Time `json:"flaggedAt" bson:"flaggedAt"`
+}
+
+// Provenance defines how a token was registered and what the ledger looked like when it was verified.
+type Provenance struct {
+	// RegisteredBy defines the admin identity or the IP of the client that registered the token.
+	RegisteredBy string `json:"registeredBy" bson:"registeredBy"`
+	// Node defines the url of the node the token was verified with.
+	Node string `json:"node" bson:"node"`
+	// MilestoneIndex defines the ledger index the foundry was read at.
+	MilestoneIndex uint32 `json:"milestoneIndex" bson:"milestoneIndex"`
+	// FoundryOutputID defines the ID of the foundry output the token was verified against.
+	FoundryOutputID string `json:"foundryOutputId" bson:"foundryOutputId"`
+}
+
+// Logo defines a content-addressed logo pinned by the registry.
+type Logo struct {
+	// Hash defines the hex encoded sha256 hash of Data.
+	Hash string `json:"hash" bson:"_id"`
+	// ContentType defines the sniffed content type of Data.
+	ContentType string `json:"contentType" bson:"contentType"`
+	// Data defines the normalized logo.
+	Data []byte `json:"-" bson:"data"`
+	// SourceURL defines the url the logo was fetched from.
+	SourceURL string `json:"sourceUrl" bson:"sourceUrl"`
+	// FetchedAt defines when the logo was fetched.
+	FetchedAt time.Time `json:"fetchedAt" bson:"fetchedAt"`
+}
+
+// TokenListVersion defines the semantic version of the token list of a network.
+type TokenListVersion struct {
+	Major int `json:"major" bson:"major"`
+	Minor int `json:"minor" bson:"minor"`
+	Patch int `json:"patch" bson:"patch"`
+}
+
+func (v TokenListVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// TokenListState defines the last published token list of a network, used to bump its version on changes.
+type TokenListState struct {
+	// Network defines the network of the token list.
+	Network string `json:"network" bson:"_id"`
+	// Version defines the version of the token list.
+	Version TokenListVersion `json:"version" bson:"version"`
+	// Timestamp defines when the version was published.
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	// Digests defines the digest of every listed token by its ID.
+	Digests map[string]string `json:"digests" bson:"digests"`
+}
+
+// NetworkSetting defines whether an admin enabled or disabled a network, shared by all instances.
+type NetworkSetting struct {
+	// Network defines the name of the network.
+	Network string `json:"network" bson:"_id"`
+	// Enabled defines whether the registry of the network is served.
+	Enabled bool `json:"enabled" bson:"enabled"`
+	// UpdatedAt defines when the setting was last changed.
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Snapshot defines a signed snapshot of the registry of a network.
+type Snapshot struct {
+	// ID defines the network and sequence of the snapshot joined by a slash.
+	ID string `json:"-" bson:"_id"`
+	// Network defines the network of the snapshot.
+	Network string `json:"network" bson:"network"`
+	// Sequence defines the number of the snapshot in its network, starting at 1.
+	Sequence uint64 `json:"sequence" bson:"sequence"`
+	// Timestamp defines when the snapshot was taken.
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	// Data defines the canonical JSON of the snapshot content.
+	Data []byte `json:"-" bson:"data"`
+	// Signature defines the Ed25519 signature of Data.
+	Signature []byte `json:"-" bson:"signature"`
+	// PublicKey defines the Ed25519 public key of the signing key.
+	PublicKey []byte `json:"-" bson:"publicKey"`
+	// Root defines the canonical JSON of the Merkle root of the snapshot tokens.
+	Root []byte `json:"-" bson:"root,omitempty"`
+	// RootSignature defines the Ed25519 signature of Root.
+	RootSignature []byte `json:"-" bson:"rootSignature,omitempty"`
 }
 
 type Service interface {
 	FindTokenBySymbol(ctx context.Context, network string, symbol string) (*IRC30Token, error)
 	FindTokenByName(ctx context.Context, network string, name string) (*IRC30Token, error)
 	SaveToken(ctx context.Context, network string, record *IRC30Token) error
+	ReplaceToken(ctx context.Context, network string, record *IRC30Token) error
 	LoadTokens(ctx context.Context, network string, ID ...string) ([]*IRC30Token, error)
 	LoadToken(ctx context.Context, network string, ID string) (*IRC30Token, error)
+	CountTokens(ctx context.Context, network string) (int64, error)
 	DeleteTokenByID(ctx context.Context, network string, ID string) error
 	DeleteTokenByName(ctx context.Context, network string, name string) error
+	SaveLogo(ctx context.Context, logo *Logo) error
+	LoadLogo(ctx context.Context, hash string) (*Logo, error)
+	LoadTokenListState(ctx context.Context, network string) (*TokenListState, error)
+	SaveTokenListState(ctx context.Context, state *TokenListState, previous *TokenListState) error
+	UpdateVerification(ctx context.Context, network string, ID string, status string, verifiedAt time.Time) error
+	FlagToken(ctx context.Context, network string, ID string, flag *TokenFlag) error
+	SetTrustLevel(ctx context.Context, network string, ID string, level string) error
+	SaveNetworkSetting(ctx context.Context, setting *NetworkSetting) error
+	LoadNetworkSettings(ctx context.Context) ([]*NetworkSetting, error)
+	SaveVerifiedIssuer(ctx context.Context, issuer *VerifiedIssuer) error
+	LoadVerifiedIssuers(ctx context.Context, network string) ([]*VerifiedIssuer, error)
+	DeleteVerifiedIssuer(ctx context.Context, network string, aliasID string) error
+}
+
+// VerifiedIssuer defines an issuer alias the registry team verified, whose tokens inherit the verified badge.
+type VerifiedIssuer struct {
+	// ID defines the network and alias ID joined by a slash.
+	ID string `json:"-" bson:"_id"`
+	// Network defines the network of the alias.
+	Network string `json:"network" bson:"network"`
+	// AliasID defines the hex encoded ID of the alias.
+	AliasID string `json:"aliasId" bson:"aliasId"`
+	// Name defines the name of the issuer shown with the badge.
+	Name string `json:"name" bson:"name"`
+	// Note defines how the issuer was verified, for the admins.
+	Note string `json:"note,omitempty" bson:"note,omitempty"`
+	// VerifiedAt defines when the alias was verified.
+	VerifiedAt time.Time `json:"verifiedAt" bson:"verifiedAt"`
+	// VerifiedBy defines the identity of the admin that verified the alias.
+	VerifiedBy string `json:"verifiedBy" bson:"verifiedBy"`
+}
+
+// Admin defines an admin account allowed to use the admin API within its scopes.
+type Admin struct {
+	// Name defines the unique name of the admin.
+	Name string `json:"name" bson:"_id"`
+	// PasswordHash defines the bcrypt hash of the admin password.
+	PasswordHash string `json:"-" bson:"passwordHash"`
+	// Scopes defines what the admin is allowed to do.
+	Scopes []string `json:"scopes" bson:"scopes"`
+	// CreatedAt defines when the admin was created.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// CreatedBy defines the identity that created the admin.
+	CreatedBy string `json:"createdBy" bson:"createdBy"`
+}
+
+// APIKey defines an API key of an admin, limited to a subset of the admin scopes.
+type APIKey struct {
+	// ID defines the public part of the key.
+	ID string `json:"ID" bson:"_id"`
+	// Admin defines the name of the admin owning the key.
+	Admin string `json:"admin" bson:"admin"`
+	// SecretHash defines the hex encoded sha256 hash of the secret part of the key.
+	SecretHash string `json:"-" bson:"secretHash"`
+	// Scopes defines what the key is allowed to do.
+	Scopes []string `json:"scopes" bson:"scopes"`
+	// CreatedAt defines when the key was created.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// AuditEntry defines an admin action recorded in the audit trail.
+type AuditEntry struct {
+	// Time defines when the action was performed.
+	Time time.Time `json:"time" bson:"time"`
+	// Identity defines the admin, and API key if any, that performed the action.
+	Identity string `json:"identity" bson:"identity"`
+	// Action defines what was done.
+	Action string `json:"action" bson:"action"`
+	// Network defines the network the action applied to, if any.
+	Network string `json:"network,omitempty" bson:"network,omitempty"`
+	// Target defines the token, word, network or account the action applied to.
+	Target string `json:"target,omitempty" bson:"target,omitempty"`
+}
+
+// Event defines a change of the registry of a network, as pushed by the event feed.
+type Event struct {
+	// ID defines the position of the event in the feed of all networks, assigned in increasing order.
+	ID uint64 `json:"id" bson:"_id"`
+	// Type defines what happened to the token.
+	Type string `json:"type" bson:"type"`
+	// Network defines the network of the token.
+	Network string `json:"network" bson:"network"`
+	// TokenID defines the ID of the token.
+	TokenID string `json:"tokenId" bson:"tokenId"`
+	// Name defines the name of the token.
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+	// Symbol defines the symbol of the token.
+	Symbol string `json:"symbol,omitempty" bson:"symbol,omitempty"`
+	// VerificationStatus defines the new verification status of verification events.
+	VerificationStatus string `json:"verificationStatus,omitempty" bson:"verificationStatus,omitempty"`
+	// Flag defines why the token was flagged in flagged events.
+	Flag *TokenFlag `json:"flag,omitempty" bson:"flag,omitempty"`
+	// Time defines when the event happened.
+	Time time.Time `json:"time" bson:"time"`
+}
+
+type EventService interface {
+	SaveEvent(ctx context.Context, event *Event) error
+	LoadEvents(ctx context.Context, network string, after uint64, limit int64) ([]*Event, error)
+	LoadLatestEventID(ctx context.Context) (uint64, error)
+	DeleteEvents(ctx context.Context, before time.Time) error
+}
+
+// Webhook defines a partner service notified of the registry events of the networks and types it subscribed to.
+type Webhook struct {
+	// ID defines the unique ID of the webhook.
+	ID string `json:"ID" bson:"_id"`
+	// URL defines where the events are posted to.
+	URL string `json:"url" bson:"url"`
+	// Secret defines the key the payloads are signed with, it is only revealed when the webhook is created.
+	Secret string `json:"-" bson:"secret"`
+	// Networks defines the networks whose events are posted, all networks if empty.
+	Networks []string `json:"networks" bson:"networks"`
+	// EventTypes defines the types of the events that are posted, all types if empty.
+	EventTypes []string `json:"eventTypes" bson:"eventTypes"`
+	// CreatedAt defines when the webhook was created.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// CreatedBy defines the identity that created the webhook.
+	CreatedBy string `json:"createdBy" bson:"createdBy"`
+}
+
+// WebhookDelivery defines the delivery of an event to a webhook, queued until it succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	// ID defines the unique ID of the delivery, sent along with the payload.
+	ID string `json:"ID" bson:"_id"`
+	// WebhookID defines the webhook the event is delivered to.
+	WebhookID string `json:"webhookId" bson:"webhookId"`
+	// Event defines the delivered event.
+	Event *Event `json:"event" bson:"event"`
+	// Status defines whether the delivery is pending, delivered or failed.
+	Status string `json:"status" bson:"status"`
+	// Attempts defines the delivery log, the outcome of every attempt.
+	Attempts []*DeliveryAttempt `json:"attempts" bson:"attempts"`
+	// NextAttemptAt defines when a pending delivery is attempted next.
+	NextAttemptAt time.Time `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	// LeasedUntil defines until when an instance attempting the delivery reserved it, zero if it is not attempted.
+	LeasedUntil time.Time `json:"-" bson:"leasedUntil,omitempty"`
+	// CreatedAt defines when the delivery was queued.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// DeliveryAttempt defines the outcome of an attempt to deliver an event to a webhook.
+type DeliveryAttempt struct {
+	// Time defines when the attempt was made.
+	Time time.Time `json:"time" bson:"time"`
+	// StatusCode defines the HTTP status the webhook responded with, 0 if it did not respond.
+	StatusCode int `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	// Error defines why the attempt failed.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// DurationMs defines how long the attempt took in milliseconds.
+	DurationMs int64 `json:"durationMs" bson:"durationMs"`
+}
+
+type WebhookService interface {
+	SaveWebhook(ctx context.Context, webhook *Webhook) error
+	LoadWebhook(ctx context.Context, ID string) (*Webhook, error)
+	LoadWebhooks(ctx context.Context) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, ID string) error
+	SaveWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error
+	ClaimWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (*WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	RetryWebhookDelivery(ctx context.Context, ID string, now time.Time) (*WebhookDelivery, error)
+	LoadWebhookDelivery(ctx context.Context, ID string) (*WebhookDelivery, error)
+	LoadWebhookDeliveries(ctx context.Context, webhookID string, status string, limit int64) ([]*WebhookDelivery, error)
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) error
+}
+
+// Report defines an abuse report of a registered token, e.g. of an impersonation or a scam.
+type Report struct {
+	// ID defines the unique ID of the report.
+	ID string `json:"ID" bson:"_id"`
+	// Network defines the network of the reported token.
+	Network string `json:"network" bson:"network"`
+	// TokenID defines the ID of the reported token.
+	TokenID string `json:"tokenId" bson:"tokenId"`
+	// Reason defines the category of the report.
+	Reason string `json:"reason" bson:"reason"`
+	// Text defines the description of the reporter.
+	Text string `json:"text" bson:"text"`
+	// Status defines whether the report is open, resolved or dismissed.
+	Status string `json:"status" bson:"status"`
+	// ReportedBy defines the IP of the reporting client.
+	ReportedBy string `json:"reportedBy" bson:"reportedBy"`
+	// CreatedAt defines when the report was received.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// Resolution defines how an admin triaged the report, nil while it is open.
+	Resolution *ReportResolution `json:"resolution,omitempty" bson:"resolution,omitempty"`
+}
+
+// ReportResolution defines how an admin triaged a report.
+type ReportResolution struct {
+	// Action defines what happened to the token: none, flag or remove.
+	Action string `json:"action" bson:"action"`
+	// Note defines the comment of the admin.
+	Note string `json:"note,omitempty" bson:"note,omitempty"`
+	// ResolvedBy defines the identity of the admin.
+	ResolvedBy string `json:"resolvedBy" bson:"resolvedBy"`
+	// ResolvedAt defines when the report was triaged.
+	ResolvedAt time.Time `json:"resolvedAt" bson:"resolvedAt"`
+}
+
+type ReportService interface {
+	SaveReport(ctx context.Context, report *Report) error
+	LoadReport(ctx context.Context, ID string) (*Report, error)
+	LoadReports(ctx context.Context, network string, status string, limit int64) ([]*Report, error)
+	ResolveReport(ctx context.Context, ID string, status string, resolution *ReportResolution) error
+	ResolveTokenReports(ctx context.Context, network string, tokenID string, resolution *ReportResolution) (int64, error)
+}
+
+// Lease defines which instance runs a worker that must run on a single instance at a time.
+type Lease struct {
+	// Name defines the worker the lease is held for.
+	Name string `json:"name" bson:"_id"`
+	// Holder defines the instance holding the lease.
+	Holder string `json:"holder" bson:"holder"`
+	// ExpiresAt defines when the lease expires unless the holder renews it.
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type LeaseService interface {
+	ClaimLease(ctx context.Context, name string, holder string, now time.Time, ttl time.Duration) (bool, error)
+}
+
+type SnapshotService interface {
+	SaveSnapshot(ctx context.Context, snapshot *Snapshot) error
+	LoadSnapshot(ctx context.Context, network string, sequence uint64) (*Snapshot, error)
+	LoadLatestSnapshot(ctx context.Context, network string) (*Snapshot, error)
+	DeleteSnapshots(ctx context.Context, network string, before uint64) error
+}
+
+type AdminService interface {
+	SaveAdmin(ctx context.Context, admin *Admin) error
+	LoadAdmin(ctx context.Context, name string) (*Admin, error)
+	LoadAdmins(ctx context.Context) ([]*Admin, error)
+	DeleteAdmin(ctx context.Context, name string) error
+	SaveAPIKey(ctx context.Context, key *APIKey) error
+	LoadAPIKey(ctx context.Context, ID string) (*APIKey, error)
+	LoadAPIKeys(ctx context.Context, admin string) ([]*APIKey, error)
+	DeleteAPIKey(ctx context.Context, ID string) error
+	SaveAuditEntry(ctx context.Context, entry *AuditEntry) error
+	LoadAuditEntries(ctx context.Context, limit int64) ([]*AuditEntry, error)
 }
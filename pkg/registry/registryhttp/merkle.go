@@ -0,0 +1,132 @@
+package registryhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+)
+
+// The leaves and inner nodes of the Merkle tree are hashed with different prefixes, so a leaf can not be passed off
+// as an inner node.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// ProofStep defines a sibling on the path from a leaf to the Merkle root.
+type ProofStep struct {
+	// Hash defines the hex encoded hash of the sibling.
+	Hash string `json:"hash"`
+	// Left tells whether the sibling is the left child of the parent.
+	Left bool `json:"left"`
+}
+
+// MerkleTree defines a Merkle tree over the canonical token records of a network, ordered by token ID. A node without
+// sibling is promoted to the next level unchanged.
+type MerkleTree struct {
+	IDs    []string
+	levels [][][]byte
+}
+
+// NewTokenMerkleTree builds the Merkle tree over tokens.
+func NewTokenMerkleTree(tokens []*registry.IRC30Token) (*MerkleTree, error) {
+	sorted := make([]*registry.IRC30Token, len(tokens))
+	copy(sorted, tokens)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	tree := &MerkleTree{IDs: make([]string, len(sorted))}
+	leaves := make([][]byte, len(sorted))
+	for i, token := range sorted {
+		leaf, err := TokenLeafHash(token)
+		if err != nil {
+			return nil, err
+		}
+		tree.IDs[i] = token.ID
+		leaves[i] = leaf
+	}
+	tree.levels = [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNodeHash(level[i], level[i+1]))
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree, nil
+}
+
+// Root returns the Merkle root, the hash of no data for an empty tree.
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	return top[0]
+}
+
+// Proof returns the inclusion proof of the token with the given ID, false if the tree does not contain it.
+func (t *MerkleTree) Proof(ID string) ([]*ProofStep, bool) {
+	index := sort.SearchStrings(t.IDs, ID)
+	if index == len(t.IDs) || t.IDs[index] != ID {
+		return nil, false
+	}
+	steps := make([]*ProofStep, 0, len(t.levels)-1)
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			steps = append(steps, &ProofStep{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		index /= 2
+	}
+	return steps, true
+}
+
+// TokenLeafHash hashes the canonical JSON of a token as a leaf of the Merkle tree.
+func TokenLeafHash(token *registry.IRC30Token) ([]byte, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode token")
+	}
+	if data, err = CanonicalJSON(data); err != nil {
+		return nil, errors.Wrap(err, "failed to canonicalize token")
+	}
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+	return hash[:], nil
+}
+
+// VerifyProof checks that the leaf and the proof steps hash to root.
+func VerifyProof(leaf []byte, steps []*ProofStep, root []byte) (bool, error) {
+	hash := leaf
+	for _, step := range steps {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to decode proof step")
+		}
+		if step.Left {
+			hash = merkleNodeHash(sibling, hash)
+		} else {
+			hash = merkleNodeHash(hash, sibling)
+		}
+	}
+	return bytes.Equal(hash, root), nil
+}
+
+func merkleNodeHash(left []byte, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
@@ -0,0 +1,115 @@
+package registryhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+)
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		t.Run(fmt.Sprintf("%d tokens", n), func(t *testing.T) {
+			tokens := testTokens(n)
+			tree, err := NewTokenMerkleTree(tokens)
+			if err != nil {
+				t.Fatalf("NewTokenMerkleTree() error = %v", err)
+			}
+			for _, token := range tokens {
+				steps, ok := tree.Proof(token.ID)
+				if !ok {
+					t.Fatalf("Proof(%s) found no token", token.ID)
+				}
+				leaf, err := TokenLeafHash(token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok, err := VerifyProof(leaf, steps, tree.Root()); err != nil || !ok {
+					t.Errorf("VerifyProof(%s) = %v, %v, want true", token.ID, ok, err)
+				}
+
+				tampered := *token
+				tampered.MaxSupply = "1"
+				leaf, err = TokenLeafHash(&tampered)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok, _ := VerifyProof(leaf, steps, tree.Root()); ok {
+					t.Errorf("VerifyProof(%s) accepted a tampered token", token.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleProofUnknownToken(t *testing.T) {
+	tree, err := NewTokenMerkleTree(testTokens(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Proof("0xunknown"); ok {
+		t.Error("Proof() found a token that is not part of the tree")
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	tokens := testTokens(5)
+	tree, err := NewTokenMerkleTree(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]*registry.IRC30Token, len(tokens))
+	for i, token := range tokens {
+		reversed[len(tokens)-1-i] = token
+	}
+	reversedTree, err := NewTokenMerkleTree(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tree.Root(), reversedTree.Root()) {
+		t.Error("the Merkle root depends on the order of the tokens")
+	}
+
+	single, err := NewTokenMerkleTree(tokens[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := TokenLeafHash(tokens[0]); !bytes.Equal(single.Root(), leaf) {
+		t.Error("the Merkle root of a single token is not its leaf hash")
+	}
+
+	empty, err := NewTokenMerkleTree(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := sha256.Sum256(nil); !bytes.Equal(empty.Root(), hash[:]) {
+		t.Error("the Merkle root of no tokens is not the hash of no data")
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := map[string]string{
+		`{"b": 1, "a": {"d": [1, 2], "c": "x"}}`: `{"a":{"c":"x","d":[1,2]},"b":1}`,
+		`{"html": "<a href=\"x\">&</a>"}`:        `{"html":"<a href=\"x\">&</a>"}`,
+		`{"big": 12345678901234567890}`:          `{"big":12345678901234567890}`,
+	}
+	for in, want := range tests {
+		got, err := CanonicalJSON([]byte(in))
+		if err != nil || string(got) != want {
+			t.Errorf("CanonicalJSON(%s) = %s, %v, want %s", in, got, err, want)
+		}
+	}
+	if _, err := CanonicalJSON([]byte(`{} {}`)); err == nil {
+		t.Error("CanonicalJSON() accepted data after the document")
+	}
+}
+
+func testTokens(n int) []*registry.IRC30Token {
+	tokens := make([]*registry.IRC30Token, n)
+	for i := range tokens {
+		tokens[i] = &registry.IRC30Token{ID: fmt.Sprintf("0x08%02d", n-i), Name: fmt.Sprintf("Token %d", i), Symbol: "TK", MaxSupply: "1000"}
+	}
+	return tokens
+}
@@ -0,0 +1,13 @@
+package registryhttp
+
+import _ "embed"
+
+const (
+	OpenAPIEndpoint = "/openapi.json"
+	DocsEndpoint    = "/docs"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing the registry API.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
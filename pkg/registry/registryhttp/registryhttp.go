@@ -1,14 +1,501 @@
 package registryhttp
 
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+)
+
 const (
 	RegistriesEndpoint = "/registries"
 	TokensEndpoint     = "/tokens"
+	AdminEndpoint      = "/admin"
+	FiltersEndpoint    = "/filters"
+	NetworksEndpoint   = "/networks"
+	ByIDEndpoint       = "/byID"
+	ByNameEndpoint     = "/byName"
+	ValidateEndpoint   = "/validate"
+	LogoEndpoint       = "/logo"
+	LogosEndpoint      = "/logos"
+	HealthEndpoint     = "/health"
+	AdminsEndpoint     = "/admins"
+	KeysEndpoint       = "/keys"
+	AuditEndpoint      = "/audit"
+	WhoAmIEndpoint     = "/whoami"
+	APIv1Endpoint      = "/api/v1"
+	APIv2Endpoint      = "/api/v2"
+	TokenListEndpoint  = "/tokenlist.json"
+	RootEndpoint       = "/root"
+	ExportEndpoint     = "/export"
+	ImportEndpoint     = "/import"
+	ProofEndpoint      = "/proof"
+	SnapshotsEndpoint  = "/snapshots"
+	LatestEndpoint     = "/latest"
+	EventsEndpoint     = "/events"
+	WebhooksEndpoint   = "/webhooks"
+	DeliveriesEndpoint = "/deliveries"
+	RetryEndpoint      = "/retry"
+	ReportsEndpoint    = "/reports"
+	ResolveEndpoint    = "/resolve"
+	DismissEndpoint    = "/dismiss"
+	TrustEndpoint      = "/trust"
+	IssuersEndpoint    = "/issuers"
+
+	// LastEventIDHeader defines the header clients resume the event feed with, as sent by browsers reconnecting an
+	// EventSource. The lastEventId query parameter is accepted as well, e.g. for WebSocket clients.
+	LastEventIDHeader = "Last-Event-ID"
 )
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// RequestID identifies the failed request in the server logs.
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func NewErrorResponse(err error) *ErrorResponse {
 	return &ErrorResponse{Error: err.Error()}
 }
+
+// CheckResult is the outcome of a single registration check.
+type CheckResult struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidationResponse reports the outcome of every registration check of a token.
+type ValidationResponse struct {
+	Valid  bool           `json:"valid"`
+	Checks []*CheckResult `json:"checks"`
+}
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthResponse reports the health of the server and of each of its dependencies.
+type HealthResponse struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyHealth `json:"dependencies,omitempty"`
+}
+
+// DependencyHealth reports the health of a single dependency.
+type DependencyHealth struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	// ConfirmedMilestoneIndex and LatestMilestoneIndex are reported by nodes only.
+	ConfirmedMilestoneIndex uint32 `json:"confirmedMilestoneIndex,omitempty"`
+	LatestMilestoneIndex    uint32 `json:"latestMilestoneIndex,omitempty"`
+}
+
+// CreateAdminRequest defines the admin account to create.
+type CreateAdminRequest struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Scopes   []string `json:"scopes"`
+}
+
+// CreateAPIKeyRequest defines the scopes of the API key to create.
+type CreateAPIKeyRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+// CreateAPIKeyResponse returns a created API key. Key is the only time the secret is revealed.
+type CreateAPIKeyResponse struct {
+	Key    string           `json:"key"`
+	APIKey *registry.APIKey `json:"apiKey"`
+}
+
+// IdentityResponse describes the authenticated admin.
+type IdentityResponse struct {
+	Admin  string   `json:"admin"`
+	KeyID  string   `json:"keyID,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+const (
+	// VerificationVerified marks tokens that matched the ledger when last verified.
+	VerificationVerified = "verified"
+	// VerificationMismatch marks tokens whose foundry no longer matches the registered maximum supply.
+	VerificationMismatch = "mismatch"
+	// VerificationUnavailable marks tokens that could not be checked against the ledger.
+	VerificationUnavailable = "unavailable"
+	// VerificationUnverified marks tokens the registry did not verify against the ledger yet, e.g. as they were
+	// imported without verification.
+	VerificationUnverified = "unverified"
+)
+
+const (
+	// TrustUnverified marks tokens the registry did not verify against the ledger, that no longer match it, or that an
+	// admin distrusts.
+	TrustUnverified = "unverified"
+	// TrustLedgerVerified marks tokens the registry verified against the ledger.
+	TrustLedgerVerified = "ledger-verified"
+	// TrustIssuerSigned marks ledger-verified tokens whose issuer alias the registry team verified.
+	TrustIssuerSigned = "issuer-signed"
+	// TrustTeamVetted marks tokens the registry team vetted.
+	TrustTeamVetted = "team-vetted"
+)
+
+// TrustLevels are the trust levels of tokens, from the lowest to the highest.
+var TrustLevels = []string{TrustUnverified, TrustLedgerVerified, TrustIssuerSigned, TrustTeamVetted}
+
+// TrustRank orders the trust levels, it returns -1 for unknown levels.
+func TrustRank(level string) int {
+	for i, l := range TrustLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// TokenV2 is the token representation of API v2, which adds registry metadata to the registered token.
+type TokenV2 struct {
+	*registry.IRC30Token
+	// IssuerAlias defines the alias controlling the foundry of the token.
+	IssuerAlias *IssuerAlias `json:"issuerAlias"`
+	// Verification defines the outcome of the last verification against the ledger.
+	Verification *Verification `json:"verification"`
+	// CreatedAt and UpdatedAt are unset for tokens registered before API v2.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// Provenance defines how the token was registered, unset for tokens registered before API v2.
+	Provenance *registry.Provenance `json:"provenance,omitempty"`
+	// Supply defines the current supply, it is only returned for single tokens.
+	Supply *TokenSupply `json:"supply,omitempty"`
+	// Flag warns that an admin confirmed a report of the token, unset for tokens that are not flagged.
+	Flag *registry.TokenFlag `json:"flag,omitempty"`
+	// TrustLevel defines how far the token can be trusted, assigned by an admin or derived from the checks.
+	TrustLevel string `json:"trustLevel"`
+}
+
+// IssuerAlias identifies the alias controlling a foundry.
+type IssuerAlias struct {
+	AliasID string `json:"aliasId"`
+	// Address defines the bech32 address of the alias, empty if the network prefix is unknown.
+	Address string `json:"address,omitempty"`
+	// Verified tells whether the registry team verified the issuer, Name is the verified name of the issuer.
+	Verified bool   `json:"verified"`
+	Name     string `json:"name,omitempty"`
+}
+
+// Verification reports whether a token matches the ledger.
+type Verification struct {
+	Status     string     `json:"status"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// TokenSupply reports the supply of a token as decimal strings.
+type TokenSupply struct {
+	MaximumSupply     string `json:"maximumSupply"`
+	MintedTokens      string `json:"mintedTokens"`
+	MeltedTokens      string `json:"meltedTokens"`
+	CirculatingSupply string `json:"circulatingSupply"`
+}
+
+const (
+	// EventTokenRegistered is pushed when a token is registered or imported.
+	EventTokenRegistered = "token.registered"
+	// EventTokenUpdated is pushed when a registered token is overwritten by an import.
+	EventTokenUpdated = "token.updated"
+	// EventTokenDeleted is pushed when an admin deletes a token.
+	EventTokenDeleted = "token.deleted"
+	// EventTokenVerification is pushed when the verification status of a token changes.
+	EventTokenVerification = "token.verification"
+	// EventTokenFlagged is pushed when an admin flags a reported token.
+	EventTokenFlagged = "token.flagged"
+)
+
+// EventTypes are the types of the registry events.
+var EventTypes = []string{EventTokenRegistered, EventTokenUpdated, EventTokenDeleted, EventTokenVerification, EventTokenFlagged}
+
+const (
+	// DeliveryPending marks webhook deliveries waiting for their next attempt.
+	DeliveryPending = "pending"
+	// DeliveryDelivered marks webhook deliveries the webhook accepted.
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed marks webhook deliveries that ran out of attempts.
+	DeliveryFailed = "failed"
+
+	// WebhookSignatureHeader defines the header carrying the signature of a webhook payload, formatted as
+	// t=<unix time>,v1=<hex encoded HMAC-SHA256 of "<unix time>.<body>" keyed with the webhook secret>.
+	WebhookSignatureHeader = "X-Registry-Signature"
+	// WebhookEventHeader defines the header carrying the event type of a webhook payload.
+	WebhookEventHeader = "X-Registry-Event"
+	// WebhookDeliveryHeader defines the header carrying the delivery ID of a webhook payload, which stays the same
+	// when the delivery is retried.
+	WebhookDeliveryHeader = "X-Registry-Delivery"
+)
+
+// WebhookPayload defines the body posted to webhooks.
+type WebhookPayload struct {
+	DeliveryID string          `json:"deliveryId"`
+	WebhookID  string          `json:"webhookId"`
+	Event      *registry.Event `json:"event"`
+}
+
+// CreateWebhookRequest defines the webhook to create. Empty networks or event types subscribe to all of them.
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	Networks   []string `json:"networks"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+// CreateWebhookResponse returns a created webhook. Secret is the only time the signing key is revealed.
+type CreateWebhookResponse struct {
+	Secret  string            `json:"secret"`
+	Webhook *registry.Webhook `json:"webhook"`
+}
+
+// WebhookSignature signs a webhook payload sent at timestamp with secret, as sent in the WebhookSignatureHeader.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+const (
+	// TokenListTagAdmin marks tokens registered by an admin.
+	TokenListTagAdmin = "admin"
+	// TokenListTagLegacy marks tokens registered before the registry recorded their provenance.
+	TokenListTagLegacy = "legacy"
+	// TokenListTagFlagged marks tokens flagged by an admin after they were reported.
+	TokenListTagFlagged = "flagged"
+)
+
+// TokenList defines the tokens of a network in the token-list format consumed by wallets and explorers.
+type TokenList struct {
+	Name      string                    `json:"name"`
+	Timestamp time.Time                 `json:"timestamp"`
+	Version   registry.TokenListVersion `json:"version"`
+	Tokens    []*TokenListEntry         `json:"tokens"`
+	Tags      map[string]*TokenListTag  `json:"tags,omitempty"`
+}
+
+// TokenListEntry defines a token of a TokenList.
+type TokenListEntry struct {
+	Network string `json:"network"`
+	// Address defines the token ID.
+	Address  string   `json:"address"`
+	Name     string   `json:"name"`
+	Symbol   string   `json:"symbol"`
+	Decimals uint     `json:"decimals"`
+	LogoURI  string   `json:"logoURI,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// TokenListTag describes a tag used by the entries of a TokenList.
+type TokenListTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TokenRecord defines a token with the fields set by the registry, as exported and imported by admins one per line.
+type TokenRecord struct {
+	Network string `json:"network"`
+	*registry.IRC30Token
+	CreatedAt  *time.Time           `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time           `json:"updatedAt,omitempty"`
+	VerifiedAt *time.Time           `json:"verifiedAt,omitempty"`
+	Provenance *registry.Provenance `json:"provenance,omitempty"`
+	// VerificationStatus defines the outcome of the last live verification, empty if it matched ever since.
+	VerificationStatus string `json:"verificationStatus,omitempty"`
+	// Flag defines why the token was flagged, if so.
+	Flag *registry.TokenFlag `json:"flag,omitempty"`
+	// TrustLevel defines the trust level assigned by an admin, empty if it is derived.
+	TrustLevel string `json:"trustLevel,omitempty"`
+	// PinnedLogo defines the logo LogoHash refers to.
+	PinnedLogo *PinnedLogo `json:"pinnedLogo,omitempty"`
+}
+
+// PinnedLogo defines a logo pinned by the registry in a TokenRecord.
+type PinnedLogo struct {
+	ContentType string    `json:"contentType"`
+	SourceURL   string    `json:"sourceUrl"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	Data        []byte    `json:"data"`
+}
+
+const (
+	// ImportConflictSkip keeps the stored token if an imported token has the same ID.
+	ImportConflictSkip = "skip"
+	// ImportConflictOverwrite replaces the stored token if an imported token has the same ID.
+	ImportConflictOverwrite = "overwrite"
+	// ImportConflictFail fails the import if an imported token has the same ID as a stored one.
+	ImportConflictFail = "fail"
+
+	ImportActionCreate    = "create"
+	ImportActionOverwrite = "overwrite"
+	ImportActionSkip      = "skip"
+	ImportActionFail      = "fail"
+)
+
+// ImportResult reports what an import did, or would do in a dry-run, with the token of a line.
+type ImportResult struct {
+	Line   int    `json:"line"`
+	ID     string `json:"ID,omitempty"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportResponse reports the outcome of an import. Nothing is written if any line failed.
+type ImportResponse struct {
+	DryRun      bool            `json:"dryRun"`
+	Applied     bool            `json:"applied"`
+	Created     int             `json:"created"`
+	Overwritten int             `json:"overwritten"`
+	Skipped     int             `json:"skipped"`
+	Failed      int             `json:"failed"`
+	Results     []*ImportResult `json:"results"`
+}
+
+// SnapshotAlgorithm defines the signature algorithm of the registry snapshots.
+const SnapshotAlgorithm = "ed25519"
+
+// SnapshotContent defines the content of a registry snapshot, which is signed as canonical JSON.
+type SnapshotContent struct {
+	Network   string                 `json:"network"`
+	Sequence  uint64                 `json:"sequence"`
+	Timestamp time.Time              `json:"timestamp"`
+	Tokens    []*registry.IRC30Token `json:"tokens"`
+	// MerkleRoot defines the hex encoded Merkle root of Tokens.
+	MerkleRoot string `json:"merkleRoot"`
+}
+
+// SignedSnapshot defines a registry snapshot and its signature. The snapshot can be reformatted, the signature
+// covers its canonical JSON.
+type SignedSnapshot struct {
+	Snapshot  json.RawMessage `json:"snapshot"`
+	Algorithm string          `json:"algorithm"`
+	// PublicKey defines the hex encoded key of the signer. Clients verify with the key they pinned, not with this one.
+	PublicKey string `json:"publicKey"`
+	// Signature defines the hex encoded signature of the canonical JSON of Snapshot.
+	Signature string `json:"signature"`
+}
+
+// MerkleRoot defines the Merkle root of the tokens of a network at a snapshot, which is signed as canonical JSON.
+type MerkleRoot struct {
+	Network   string    `json:"network"`
+	Sequence  uint64    `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	// Root defines the hex encoded Merkle root.
+	Root   string `json:"root"`
+	Tokens int    `json:"tokens"`
+}
+
+// SignedRoot defines a Merkle root and its signature, signed like a SignedSnapshot.
+type SignedRoot struct {
+	Root      json.RawMessage `json:"root"`
+	Algorithm string          `json:"algorithm"`
+	PublicKey string          `json:"publicKey"`
+	Signature string          `json:"signature"`
+}
+
+// InclusionProof proves that a token is part of the signed Merkle root of a snapshot.
+type InclusionProof struct {
+	Token *registry.IRC30Token `json:"token"`
+	Steps []*ProofStep         `json:"steps"`
+	Root  *SignedRoot          `json:"root"`
+}
+
+// CanonicalJSON re-encodes a JSON document canonically: object keys sorted, no insignificant whitespace and no
+// HTML escaping. Numbers are kept as written.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+const (
+	// ReportReasonImpersonation reports tokens posing as another token or project.
+	ReportReasonImpersonation = "impersonation"
+	// ReportReasonScam reports tokens used to defraud their holders.
+	ReportReasonScam = "scam"
+	// ReportReasonOffensive reports tokens with offensive names, descriptions or logos.
+	ReportReasonOffensive = "offensive"
+	// ReportReasonOther reports tokens for any other reason, described in the text.
+	ReportReasonOther = "other"
+
+	// ReportOpen marks reports waiting for an admin.
+	ReportOpen = "open"
+	// ReportResolved marks reports an admin confirmed.
+	ReportResolved = "resolved"
+	// ReportDismissed marks reports an admin rejected.
+	ReportDismissed = "dismissed"
+
+	// ReportActionNone resolves a report leaving the token as is.
+	ReportActionNone = "none"
+	// ReportActionFlag resolves a report flagging the token.
+	ReportActionFlag = "flag"
+	// ReportActionRemove resolves a report deleting the token.
+	ReportActionRemove = "remove"
+)
+
+// ReportReasons are the reasons tokens can be reported for.
+var ReportReasons = []string{ReportReasonImpersonation, ReportReasonScam, ReportReasonOffensive, ReportReasonOther}
+
+// CreateReportRequest defines an abuse report of a token.
+type CreateReportRequest struct {
+	Reason string `json:"reason"`
+	Text   string `json:"text"`
+}
+
+// CreateReportResponse confirms a received report.
+type CreateReportResponse struct {
+	ID     string `json:"ID"`
+	Status string `json:"status"`
+}
+
+// ResolveReportRequest defines how an admin triages a report. Action is ignored when dismissing.
+type ResolveReportRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+// ReportGroup defines the reports of a token, as listed to the admins.
+type ReportGroup struct {
+	Network string `json:"network"`
+	TokenID string `json:"tokenId"`
+	// Name and Symbol are empty if the token is no longer registered.
+	Name       string              `json:"name,omitempty"`
+	Symbol     string              `json:"symbol,omitempty"`
+	Registered bool                `json:"registered"`
+	Flag       *registry.TokenFlag `json:"flag,omitempty"`
+	Reports    []*registry.Report  `json:"reports"`
+}
+
+// SetTrustLevelRequest defines the trust level an admin assigns to a token, empty to derive it from the checks again.
+type SetTrustLevelRequest struct {
+	TrustLevel string `json:"trustLevel"`
+}
+
+// VerifyIssuerRequest defines the issuer alias an admin verifies.
+type VerifyIssuerRequest struct {
+	Name string `json:"name"`
+	Note string `json:"note"`
+}
@@ -0,0 +1,13 @@
+package registryhttp
+
+import "testing"
+
+func TestWebhookSignature(t *testing.T) {
+	want := "t=1700000000,v1=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got := WebhookSignature("secret", 1700000000, []byte(`{"a":1}`)); got != want {
+		t.Errorf("WebhookSignature() = %s, want %s", got, want)
+	}
+	if WebhookSignature("other", 1700000000, []byte(`{"a":1}`)) == want {
+		t.Error("WebhookSignature() does not depend on the secret")
+	}
+}
@@ -0,0 +1,280 @@
+package registrycli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registryclient"
+)
+
+const (
+	exportFormatJSON  = "json"
+	exportFormatJSONL = "jsonl"
+)
+
+func filtersCommand(args []string) error {
+	return subcommand("filters", args, map[string]func(args []string) error{
+		"list":   listFilters,
+		"add":    addFilter,
+		"delete": deleteFilter,
+	})
+}
+
+func listFilters(args []string) error {
+	fs, o := newFlagSet("filters list")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	words, err := o.client().LoadFilter(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Strings(words)
+	return writeWords(stdout, o.output, "WORD", words)
+}
+
+func addFilter(args []string) error {
+	fs, o := newFlagSet("filters add")
+	if err := parse(fs, o, args, 1, "<word>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	return o.client().AddFilter(ctx, fs.Arg(0))
+}
+
+func deleteFilter(args []string) error {
+	fs, o := newFlagSet("filters delete")
+	if err := parse(fs, o, args, 1, "<word>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	return o.client().DeleteFilter(ctx, fs.Arg(0))
+}
+
+func networksCommand(args []string) error {
+	return subcommand("networks", args, map[string]func(args []string) error{
+		"list":    listNetworks,
+		"enable":  setNetwork(true),
+		"disable": setNetwork(false),
+	})
+}
+
+func listNetworks(args []string) error {
+	fs, o := newFlagSet("networks list")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	networks, err := o.client().LoadNetworks(ctx)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, networks)
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, []string{name, fmt.Sprint(networks[name])})
+	}
+	return writeTable(stdout, []string{"NETWORK", "ENABLED"}, rows)
+}
+
+func setNetwork(enabled bool) func(args []string) error {
+	name := "networks disable"
+	if enabled {
+		name = "networks enable"
+	}
+	return func(args []string) error {
+		fs, o := newFlagSet(name)
+		if err := parse(fs, o, args, 1, "<network>"); err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+
+		return o.client().SetNetwork(ctx, fs.Arg(0), enabled)
+	}
+}
+
+// exportCommand writes the tokens of the selected networks as a JSON object keyed by network, or with -format=jsonl
+// the admin token records, including status and provenance, as JSON Lines.
+func exportCommand(args []string) error {
+	fs, o := newFlagSet("export")
+	network := fs.String("network", "", "network to export, all enabled networks if empty")
+	file := fs.String("file", "", "file to write the export to, stdout if empty")
+	format := fs.String("format", exportFormatJSON, "export format, json for the public token data or jsonl for the admin records")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	if *format != exportFormatJSON && *format != exportFormatJSONL {
+		return errors.Newf("unknown export format %q", *format)
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+	client := o.client()
+
+	networks := []string{*network}
+	if *network == "" {
+		known, err := client.LoadNetworks(ctx)
+		if err != nil {
+			return err
+		}
+		networks = networks[:0]
+		for name, enabled := range known {
+			if enabled {
+				networks = append(networks, name)
+			}
+		}
+		sort.Strings(networks)
+	}
+
+	if *format == exportFormatJSONL {
+		return exportRecords(ctx, client, networks, *file)
+	}
+
+	export := make(map[string][]*registry.IRC30Token, len(networks))
+	for _, name := range networks {
+		tokens, err := client.LoadTokens(ctx, name)
+		if err != nil {
+			return err
+		}
+		export[name] = tokens
+	}
+
+	if *file == "" {
+		if o.output == outputTable {
+			for _, name := range networks {
+				fmt.Fprintf(stdout, "# %s\n", name)
+				if err := writeTokens(stdout, outputTable, export[name]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return writeJSON(stdout, export)
+	}
+	return writeJSONFile(*file, export)
+}
+
+// exportRecords writes the token records of networks as JSON Lines to file or stdout.
+func exportRecords(ctx context.Context, client *registryclient.HTTPClient, networks []string, file string) error {
+	if file == "" {
+		for _, network := range networks {
+			if err := client.ExportTokens(ctx, network, stdout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to create export file")
+	}
+	for _, network := range networks {
+		if err := client.ExportTokens(ctx, network, f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return errors.Wrap(f.Close(), "failed to write export file")
+}
+
+// importCommand imports token records exported with -format=jsonl. The records are imported into the network they
+// were exported from, or all into -network if set.
+func importCommand(args []string) error {
+	fs, o := newFlagSet("import")
+	network := fs.String("network", "", "network to import into, the network of each record if empty")
+	file := fs.String("file", "", "path of the JSON Lines file holding the token records")
+	conflict := fs.String("conflict", "fail", "what to do with tokens registered already: skip, overwrite or fail")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without writing anything")
+	verify := fs.Bool("verify", false, "verify every imported token against the node again")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return errors.Wrap(err, "failed to read import file")
+	}
+
+	// group the lines by network, keeping their order
+	var networks []string
+	lines := make(map[string][]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		target := *network
+		if target == "" {
+			var record struct {
+				Network string `json:"network"`
+			}
+			if err := json.Unmarshal([]byte(line), &record); err != nil || record.Network == "" {
+				return errors.Newf("line %d has no network, set -network", i+1)
+			}
+			target = record.Network
+		} else {
+			// the server rejects records of other networks
+			line = retargetRecord(line, target)
+		}
+		if _, ok := lines[target]; !ok {
+			networks = append(networks, target)
+		}
+		lines[target] = append(lines[target], line)
+	}
+
+	ctx, cancel := o.context()
+	defer cancel()
+	client := o.client()
+	options := &registryclient.ImportOptions{Conflict: *conflict, DryRun: *dryRun, Verify: *verify}
+	for _, target := range networks {
+		response, err := client.ImportTokens(ctx, target, strings.NewReader(strings.Join(lines[target], "\n")), options)
+		if response != nil {
+			fmt.Fprintf(stderr, "# %s\n", target)
+			if writeErr := writeImport(stdout, o.output, response); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "import into %s failed", target)
+		}
+	}
+	return nil
+}
+
+// retargetRecord sets the network of a record line, leaving lines that are no JSON object to fail on the server.
+func retargetRecord(line string, network string) string {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return line
+	}
+	record["network"], _ = json.Marshal(network)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return line
+	}
+	return string(data)
+}
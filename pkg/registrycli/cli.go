@@ -0,0 +1,149 @@
+// Package registrycli implements the command-line interface for registry users and admins on top of registryclient.
+package registrycli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/go-resty/resty/v2"
+
+	"github.com/lzpap/token-verifier/pkg/registryclient"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var commands = map[string]func(args []string) error{
+	"tokens":    tokensCommand,
+	"filters":   filtersCommand,
+	"networks":  networksCommand,
+	"export":    exportCommand,
+	"import":    importCommand,
+	"snapshots": snapshotsCommand,
+	"webhooks":  webhooksCommand,
+	"reports":   reportsCommand,
+	"issuers":   issuersCommand,
+}
+
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// IsCommand tells whether name is a CLI command rather than a server flag.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the CLI command in args and returns the process exit code.
+func Run(args []string) int {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		printUsage()
+		return 2
+	}
+	if err := commands[args[0]](args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(stderr, "Usage: token-verifier <%s> [subcommand] [flags]\n", strings.Join(names, "|"))
+}
+
+// options holds the flags shared by all commands.
+type options struct {
+	url      string
+	user     string
+	password string
+	apiKey   string
+	output   string
+	timeout  time.Duration
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	o := &options{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.url, "url", envOrDefault("TOKEN_VERIFIER_URL", "http://localhost:80"), "registry base url")
+	fs.StringVar(&o.user, "user", os.Getenv("TOKEN_VERIFIER_USER"), "admin basic auth user")
+	fs.StringVar(&o.password, "password", os.Getenv("TOKEN_VERIFIER_PASSWORD"), "admin basic auth password")
+	fs.StringVar(&o.apiKey, "api-key", os.Getenv("TOKEN_VERIFIER_API_KEY"), "admin API key, used instead of basic auth")
+	fs.StringVar(&o.output, "output", outputTable, "output format, table or json")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "request timeout")
+	return fs, o
+}
+
+func (o *options) validate() error {
+	if o.output != outputTable && o.output != outputJSON {
+		return errors.Newf("unknown output format %q", o.output)
+	}
+	return nil
+}
+
+func (o *options) client() *registryclient.HTTPClient {
+	restyClient := resty.New().SetHostURL(strings.TrimSuffix(o.url, "/"))
+	if o.apiKey != "" {
+		restyClient.SetHeader("X-API-Key", o.apiKey)
+	} else if o.user != "" {
+		restyClient.SetBasicAuth(o.user, o.password)
+	}
+	return registryclient.NewHTTPClient(restyClient)
+}
+
+func (o *options) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+// parse parses args into fs and checks that exactly nArgs positional arguments remain.
+func parse(fs *flag.FlagSet, o *options, args []string, nArgs int, argNames string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != nArgs {
+		return errors.Newf("usage: token-verifier %s [flags] %s", fs.Name(), argNames)
+	}
+	return o.validate()
+}
+
+func subcommand(group string, args []string, subcommands map[string]func(args []string) error) error {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 {
+		return errors.Newf("usage: token-verifier %s <%s>", group, strings.Join(names, "|"))
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return errors.Newf("unknown subcommand %q, usage: token-verifier %s <%s>", args[0], group, strings.Join(names, "|"))
+	}
+	return run(args[1:])
+}
+
+func envOrDefault(key string, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
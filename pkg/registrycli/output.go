@@ -0,0 +1,137 @@
+package registrycli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create export file")
+	}
+	if err := writeJSON(f, v); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write export file")
+	}
+	return f.Close()
+}
+
+// writeTable writes rows as aligned columns below the given header.
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func writeTokens(w io.Writer, format string, tokens []*registry.IRC30Token) error {
+	if format == outputJSON {
+		return writeJSON(w, tokens)
+	}
+	rows := make([][]string, 0, len(tokens))
+	for _, token := range tokens {
+		rows = append(rows, []string{token.ID, token.Name, token.Symbol, fmt.Sprint(token.Decimals), token.MaxSupply})
+	}
+	return writeTable(w, []string{"ID", "NAME", "SYMBOL", "DECIMALS", "MAX SUPPLY"}, rows)
+}
+
+func writeToken(w io.Writer, format string, token *registry.IRC30Token) error {
+	if format == outputJSON {
+		return writeJSON(w, token)
+	}
+	return writeTable(w, []string{"FIELD", "VALUE"}, [][]string{
+		{"ID", token.ID},
+		{"Name", token.Name},
+		{"Symbol", token.Symbol},
+		{"Description", token.Description},
+		{"Decimals", fmt.Sprint(token.Decimals)},
+		{"MaxSupply", token.MaxSupply},
+		{"URL", token.URL},
+		{"LogoURL", token.LogoURL},
+		{"Logo", fmt.Sprintf("%d hex chars", len(token.Logo))},
+	})
+}
+
+func writeWords(w io.Writer, format string, header string, words []string) error {
+	if format == outputJSON {
+		return writeJSON(w, words)
+	}
+	rows := make([][]string, 0, len(words))
+	for _, word := range words {
+		rows = append(rows, []string{word})
+	}
+	return writeTable(w, []string{header}, rows)
+}
+
+func writeValidation(w io.Writer, format string, validation *registryhttp.ValidationResponse) error {
+	if format == outputJSON {
+		return writeJSON(w, validation)
+	}
+	rows := make([][]string, 0, len(validation.Checks))
+	for _, result := range validation.Checks {
+		status := "pass"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		rows = append(rows, []string{result.Check, status, result.Error})
+	}
+	return writeTable(w, []string{"CHECK", "RESULT", "ERROR"}, rows)
+}
+
+func writeImport(w io.Writer, format string, response *registryhttp.ImportResponse) error {
+	if format == outputJSON {
+		return writeJSON(w, response)
+	}
+	rows := make([][]string, 0, len(response.Results))
+	for _, result := range response.Results {
+		rows = append(rows, []string{fmt.Sprint(result.Line), result.ID, result.Action, result.Error})
+	}
+	if err := writeTable(w, []string{"LINE", "ID", "ACTION", "ERROR"}, rows); err != nil {
+		return err
+	}
+	status := "imported"
+	if response.DryRun {
+		status = "dry-run, nothing was imported"
+	} else if !response.Applied {
+		status = "nothing was imported"
+	}
+	_, err := fmt.Fprintf(w, "%d created, %d overwritten, %d skipped, %d failed: %s\n", response.Created, response.Overwritten, response.Skipped, response.Failed, status)
+	return err
+}
+
+// writeEvent writes a single event as it arrives, as a line of JSON or as a line of text, as the columns of a stream
+// can not be aligned.
+func writeEvent(w io.Writer, format string, event *registry.Event) error {
+	if format == outputJSON {
+		return json.NewEncoder(w).Encode(event)
+	}
+	line := fmt.Sprintf("%d %s %s %s %s (%s)", event.ID, event.Time.Format(time.RFC3339), event.Type, event.TokenID, event.Name, event.Symbol)
+	if event.VerificationStatus != "" {
+		line += " " + event.VerificationStatus
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
@@ -0,0 +1,102 @@
+package registrycli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func reportsCommand(args []string) error {
+	return subcommand("reports", args, map[string]func(args []string) error{
+		"list":    listReports,
+		"resolve": resolveReport,
+		"dismiss": dismissReport,
+	})
+}
+
+// reportToken reports a token to the registry admins.
+func reportToken(args []string) error {
+	fs, o := newFlagSet("tokens report")
+	network := fs.String("network", "alphanet", "network of the registry")
+	reason := fs.String("reason", "", "reason of the report: "+strings.Join(registryhttp.ReportReasons, ", "))
+	text := fs.String("text", "", "what is wrong with the token, required for the reason other")
+	if err := parse(fs, o, args, 1, "<tokenID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	created, err := o.client().ReportToken(ctx, *network, fs.Arg(0), &registryhttp.CreateReportRequest{Reason: *reason, Text: *text})
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, created)
+	}
+	_, err = fmt.Fprintf(stdout, "received report %s\n", created.ID)
+	return err
+}
+
+// listReports prints the reports grouped by token, one line per report.
+func listReports(args []string) error {
+	fs, o := newFlagSet("reports list")
+	network := fs.String("network", "", "only reports of this network, all networks if empty")
+	status := fs.String("status", registryhttp.ReportOpen, "only reports with this status: open, resolved or dismissed")
+	limit := fs.Int("limit", 0, "maximum number of reports, the server default if 0")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	groups, err := o.client().LoadReports(ctx, *network, *status, *limit)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, groups)
+	}
+	var rows [][]string
+	for _, group := range groups {
+		token := group.Name
+		switch {
+		case !group.Registered:
+			token = "(removed)"
+		case group.Flag != nil:
+			token += " (flagged)"
+		}
+		for _, report := range group.Reports {
+			rows = append(rows, []string{report.ID, report.Network, report.TokenID, token, report.Reason, report.CreatedAt.Format(time.RFC3339), report.Text})
+		}
+	}
+	return writeTable(stdout, []string{"ID", "NETWORK", "TOKEN", "NAME", "REASON", "REPORTED", "TEXT"}, rows)
+}
+
+func resolveReport(args []string) error {
+	fs, o := newFlagSet("reports resolve")
+	action := fs.String("action", registryhttp.ReportActionNone, "what happens to the token: none, flag or remove")
+	note := fs.String("note", "", "comment on the resolution")
+	if err := parse(fs, o, args, 1, "<reportID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	_, err := o.client().ResolveReport(ctx, fs.Arg(0), *action, *note)
+	return err
+}
+
+func dismissReport(args []string) error {
+	fs, o := newFlagSet("reports dismiss")
+	note := fs.String("note", "", "comment on the dismissal")
+	if err := parse(fs, o, args, 1, "<reportID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	_, err := o.client().DismissReport(ctx, fs.Arg(0), *note)
+	return err
+}
@@ -0,0 +1,86 @@
+package registrycli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryclient"
+)
+
+func snapshotsCommand(args []string) error {
+	return subcommand("snapshots", args, map[string]func(args []string) error{
+		"get":    getSnapshot,
+		"verify": verifySnapshot,
+	})
+}
+
+// getSnapshot downloads a snapshot, verifies it against the pinned public key and writes it to a file or stdout.
+func getSnapshot(args []string) error {
+	fs, o := newFlagSet("snapshots get")
+	network := fs.String("network", "alphanet", "network of the registry")
+	sequence := fs.Uint64("sequence", 0, "sequence of the snapshot, the latest if 0")
+	publicKey := fs.String("public-key", os.Getenv("TOKEN_VERIFIER_SNAPSHOT_KEY"), "hex encoded public key the snapshot must be signed with")
+	file := fs.String("file", "", "file to write the signed snapshot to, stdout if empty")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	key, err := registryclient.ParsePublicKey(*publicKey)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	snapshot, content, err := o.client().SetSnapshotKey(key).LoadSnapshot(ctx, *network, *sequence)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return writeJSON(stdout, snapshot)
+	}
+	if err := writeJSONFile(*file, snapshot); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "wrote verified snapshot %d of %s with %d tokens to %s\n", content.Sequence, content.Network, len(content.Tokens), *file)
+	return nil
+}
+
+// verifySnapshot verifies a signed snapshot read from a file against the pinned public key, without contacting the
+// registry.
+func verifySnapshot(args []string) error {
+	fs, o := newFlagSet("snapshots verify")
+	publicKey := fs.String("public-key", os.Getenv("TOKEN_VERIFIER_SNAPSHOT_KEY"), "hex encoded public key the snapshot must be signed with")
+	file := fs.String("file", "", "path of the signed snapshot")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	key, err := registryclient.ParsePublicKey(*publicKey)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return errors.Wrap(err, "failed to read snapshot file")
+	}
+	snapshot := &registryhttp.SignedSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return errors.Wrap(err, "failed to parse snapshot file")
+	}
+	content, err := registryclient.VerifySnapshot(snapshot, key)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, content)
+	}
+	fmt.Fprintf(stderr, "snapshot %d of %s taken at %s is valid\n", content.Sequence, content.Network, content.Timestamp.Format(time.RFC3339))
+	return writeTokens(stdout, outputTable, content.Tokens)
+}
@@ -0,0 +1,285 @@
+package registrycli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// watchReconnectDelay defines how long tokens watch waits before reconnecting a broken event stream.
+const watchReconnectDelay = 5 * time.Second
+
+func tokensCommand(args []string) error {
+	return subcommand("tokens", args, map[string]func(args []string) error{
+		"list":      listTokens,
+		"get":       getToken,
+		"search":    searchTokens,
+		"submit":    submitToken,
+		"validate":  validateToken,
+		"delete":    deleteToken,
+		"logo":      downloadLogo,
+		"tokenlist": exportTokenList,
+		"watch":     watchTokens,
+		"report":    reportToken,
+		"trust":     setTrustLevel,
+	})
+}
+
+func listTokens(args []string) error {
+	fs, o := newFlagSet("tokens list")
+	network := fs.String("network", "alphanet", "network of the registry")
+	minTrust := fs.String("min-trust", "", "only tokens with at least this trust level: "+strings.Join(registryhttp.TrustLevels, ", "))
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if *minTrust != "" {
+		trusted, err := o.client().LoadTrustedTokens(ctx, *network, *minTrust)
+		if err != nil {
+			return err
+		}
+		return writeTrustedTokens(stdout, o.output, trusted)
+	}
+	tokens, err := o.client().LoadTokens(ctx, *network)
+	if err != nil {
+		return err
+	}
+	return writeTokens(stdout, o.output, tokens)
+}
+
+func getToken(args []string) error {
+	fs, o := newFlagSet("tokens get")
+	network := fs.String("network", "alphanet", "network of the registry")
+	if err := parse(fs, o, args, 1, "<tokenID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	token, err := o.client().LoadToken(ctx, *network, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeToken(stdout, o.output, token)
+}
+
+// searchTokens lists the tokens whose ID, name or symbol contain the query, ignoring case.
+func searchTokens(args []string) error {
+	fs, o := newFlagSet("tokens search")
+	network := fs.String("network", "alphanet", "network of the registry")
+	if err := parse(fs, o, args, 1, "<query>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	tokens, err := o.client().LoadTokens(ctx, *network)
+	if err != nil {
+		return err
+	}
+	query := strings.ToLower(fs.Arg(0))
+	matches := make([]*registry.IRC30Token, 0)
+	for _, token := range tokens {
+		if strings.Contains(strings.ToLower(token.ID), query) ||
+			strings.Contains(strings.ToLower(token.Name), query) ||
+			strings.Contains(strings.ToLower(token.Symbol), query) {
+			matches = append(matches, token)
+		}
+	}
+	return writeTokens(stdout, o.output, matches)
+}
+
+// submitToken registers the token read from a JSON file. With -dry-run the registry runs every registration check
+// on the token without saving it.
+func submitToken(args []string) error {
+	fs, o := newFlagSet("tokens submit")
+	network := fs.String("network", "alphanet", "network of the registry")
+	file := fs.String("file", "", "path of the JSON file holding the token")
+	dryRun := fs.Bool("dry-run", false, "run the registration checks without saving the token")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	token, err := readToken(*file)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if !*dryRun {
+		if err := o.client().SaveToken(ctx, *network, token); err != nil {
+			return err
+		}
+		return writeToken(stdout, o.output, token)
+	}
+
+	validation, err := o.client().ValidateToken(ctx, *network, token)
+	if err != nil {
+		return err
+	}
+	return reportValidation(token, validation, o.output)
+}
+
+// validateToken runs every registration check of the registry on the token read from a JSON file without saving it.
+func validateToken(args []string) error {
+	fs, o := newFlagSet("tokens validate")
+	network := fs.String("network", "alphanet", "network of the registry")
+	file := fs.String("file", "", "path of the JSON file holding the token")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	token, err := readToken(*file)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	validation, err := o.client().ValidateToken(ctx, *network, token)
+	if err != nil {
+		return err
+	}
+	return reportValidation(token, validation, o.output)
+}
+
+func reportValidation(token *registry.IRC30Token, validation *registryhttp.ValidationResponse, format string) error {
+	if err := writeValidation(stdout, format, validation); err != nil {
+		return err
+	}
+	if !validation.Valid {
+		return errors.Newf("token %s failed validation, nothing was saved", token.ID)
+	}
+	fmt.Fprintf(stderr, "token %s passed all checks, nothing was saved\n", token.ID)
+	return nil
+}
+
+func deleteToken(args []string) error {
+	fs, o := newFlagSet("tokens delete")
+	network := fs.String("network", "alphanet", "network of the registry")
+	ID := fs.String("id", "", "ID of the token to delete")
+	name := fs.String("name", "", "name of the tokens to delete")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	if (*ID == "") == (*name == "") {
+		return errors.New("exactly one of -id and -name must be set")
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if *ID != "" {
+		return o.client().DeleteTokenByID(ctx, *network, *ID)
+	}
+	return o.client().DeleteTokenByName(ctx, *network, *name)
+}
+
+// downloadLogo writes the decoded logo of a token, or a PNG thumbnail of it, to a file.
+func downloadLogo(args []string) error {
+	fs, o := newFlagSet("tokens logo")
+	network := fs.String("network", "alphanet", "network of the registry")
+	size := fs.Int("size", 0, "size of the PNG thumbnail, the original logo if 0")
+	file := fs.String("file", "", "file to write the logo to")
+	if err := parse(fs, o, args, 1, "<tokenID>"); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	logo, contentType, err := o.client().LoadLogo(ctx, *network, fs.Arg(0), *size)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*file, logo, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write logo file")
+	}
+	fmt.Fprintf(stderr, "wrote %d bytes of %s to %s\n", len(logo), contentType, *file)
+	return nil
+}
+
+// exportTokenList writes the token list of a network, as published by the registry, to a file or stdout.
+func exportTokenList(args []string) error {
+	fs, o := newFlagSet("tokens tokenlist")
+	network := fs.String("network", "alphanet", "network of the registry")
+	file := fs.String("file", "", "file to write the token list to, stdout if empty")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	tokenList, err := o.client().LoadTokenList(ctx, *network)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return writeJSON(stdout, tokenList)
+	}
+	if err := writeJSONFile(*file, tokenList); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "wrote version %s of the %s token list with %d tokens to %s\n", tokenList.Version, *network, len(tokenList.Tokens), *file)
+	return nil
+}
+
+// watchTokens prints the events of a network until interrupted, reconnecting and resuming after the last printed
+// event whenever the stream breaks.
+func watchTokens(args []string) error {
+	fs, o := newFlagSet("tokens watch")
+	network := fs.String("network", "alphanet", "network of the registry")
+	lastEventID := fs.Uint64("last-event-id", 0, "resume after this event ID, 0 starts with the next event")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := o.client()
+	last := *lastEventID
+	for {
+		var err error
+		last, err = client.StreamEvents(ctx, *network, last, func(event *registry.Event) error {
+			return writeEvent(stdout, o.output, event)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "event stream failed: %s\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchReconnectDelay):
+		}
+	}
+}
+
+func readToken(path string) (*registry.IRC30Token, error) {
+	if path == "" {
+		return nil, errors.New("-file is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read token file")
+	}
+	token := &registry.IRC30Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token file as JSON into an token")
+	}
+	return token, nil
+}
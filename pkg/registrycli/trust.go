@@ -0,0 +1,102 @@
+package registrycli
+
+import (
+	"io"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func issuersCommand(args []string) error {
+	return subcommand("issuers", args, map[string]func(args []string) error{
+		"list":     listIssuers,
+		"verify":   verifyIssuer,
+		"unverify": unverifyIssuer,
+	})
+}
+
+// setTrustLevel assigns a trust level to a token, or derives it from the checks again with -level "".
+func setTrustLevel(args []string) error {
+	fs, o := newFlagSet("tokens trust")
+	network := fs.String("network", "alphanet", "network of the registry")
+	level := fs.String("level", registryhttp.TrustTeamVetted, "trust level of the token, empty to derive it from the checks")
+	if err := parse(fs, o, args, 1, "<tokenID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	return o.client().SetTrustLevel(ctx, *network, fs.Arg(0), *level)
+}
+
+func listIssuers(args []string) error {
+	fs, o := newFlagSet("issuers list")
+	network := fs.String("network", "alphanet", "network of the registry")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	issuers, err := o.client().LoadVerifiedIssuers(ctx, *network)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, issuers)
+	}
+	rows := make([][]string, 0, len(issuers))
+	for _, issuer := range issuers {
+		rows = append(rows, []string{issuer.AliasID, issuer.Name, issuer.VerifiedBy, issuer.VerifiedAt.Format(time.RFC3339), issuer.Note})
+	}
+	return writeTable(stdout, []string{"ALIAS ID", "NAME", "VERIFIED BY", "VERIFIED", "NOTE"}, rows)
+}
+
+func verifyIssuer(args []string) error {
+	fs, o := newFlagSet("issuers verify")
+	network := fs.String("network", "alphanet", "network of the registry")
+	name := fs.String("name", "", "name of the issuer shown on the badge of its tokens")
+	note := fs.String("note", "", "comment on the verification")
+	if err := parse(fs, o, args, 1, "<aliasID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	issuer, err := o.client().VerifyIssuer(ctx, *network, fs.Arg(0), &registryhttp.VerifyIssuerRequest{Name: *name, Note: *note})
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, issuer)
+	}
+	return nil
+}
+
+func unverifyIssuer(args []string) error {
+	fs, o := newFlagSet("issuers unverify")
+	network := fs.String("network", "alphanet", "network of the registry")
+	if err := parse(fs, o, args, 1, "<aliasID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	return o.client().UnverifyIssuer(ctx, *network, fs.Arg(0))
+}
+
+// writeTrustedTokens prints tokens with their trust level and the name of their verified issuer, if any.
+func writeTrustedTokens(w io.Writer, format string, tokens []*registryhttp.TokenV2) error {
+	if format == outputJSON {
+		return writeJSON(w, tokens)
+	}
+	rows := make([][]string, 0, len(tokens))
+	for _, token := range tokens {
+		issuer := ""
+		if token.IssuerAlias != nil && token.IssuerAlias.Verified {
+			issuer = token.IssuerAlias.Name
+		}
+		rows = append(rows, []string{token.ID, token.Name, token.Symbol, token.TrustLevel, issuer})
+	}
+	return writeTable(w, []string{"ID", "NAME", "SYMBOL", "TRUST", "VERIFIED ISSUER"}, rows)
+}
@@ -0,0 +1,137 @@
+package registrycli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func webhooksCommand(args []string) error {
+	return subcommand("webhooks", args, map[string]func(args []string) error{
+		"list":       listWebhooks,
+		"create":     createWebhook,
+		"delete":     deleteWebhook,
+		"deliveries": listWebhookDeliveries,
+		"retry":      retryWebhookDelivery,
+	})
+}
+
+func listWebhooks(args []string) error {
+	fs, o := newFlagSet("webhooks list")
+	if err := parse(fs, o, args, 0, ""); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	webhooks, err := o.client().LoadWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, webhooks)
+	}
+	rows := make([][]string, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		rows = append(rows, []string{webhook.ID, webhook.URL, listOrAll(webhook.Networks), listOrAll(webhook.EventTypes), webhook.CreatedBy})
+	}
+	return writeTable(stdout, []string{"ID", "URL", "NETWORKS", "EVENT TYPES", "CREATED BY"}, rows)
+}
+
+// createWebhook creates a webhook and prints its signing secret, which is shown only once.
+func createWebhook(args []string) error {
+	fs, o := newFlagSet("webhooks create")
+	networks := fs.String("networks", "", "comma separated networks to subscribe to, all if empty")
+	eventTypes := fs.String("event-types", "", "comma separated event types to subscribe to, all if empty")
+	if err := parse(fs, o, args, 1, "<url>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	created, err := o.client().CreateWebhook(ctx, &registryhttp.CreateWebhookRequest{URL: fs.Arg(0), Networks: splitFlag(*networks), EventTypes: splitFlag(*eventTypes)})
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, created)
+	}
+	fmt.Fprintf(stdout, "created webhook %s\n", created.Webhook.ID)
+	fmt.Fprintf(stdout, "signing secret, shown only once: %s\n", created.Secret)
+	return nil
+}
+
+func deleteWebhook(args []string) error {
+	fs, o := newFlagSet("webhooks delete")
+	if err := parse(fs, o, args, 1, "<webhook ID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	return o.client().DeleteWebhook(ctx, fs.Arg(0))
+}
+
+// listWebhookDeliveries prints the delivery log of a webhook, newest first.
+func listWebhookDeliveries(args []string) error {
+	fs, o := newFlagSet("webhooks deliveries")
+	status := fs.String("status", "", "only deliveries with this status: pending, delivered or failed")
+	limit := fs.Int("limit", 0, "maximum number of deliveries, the server default if 0")
+	if err := parse(fs, o, args, 1, "<webhook ID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	deliveries, err := o.client().LoadWebhookDeliveries(ctx, fs.Arg(0), *status, *limit)
+	if err != nil {
+		return err
+	}
+	if o.output == outputJSON {
+		return writeJSON(stdout, deliveries)
+	}
+	rows := make([][]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		var lastError string
+		if n := len(delivery.Attempts); n > 0 {
+			lastError = delivery.Attempts[n-1].Error
+		}
+		next := ""
+		if delivery.Status == registryhttp.DeliveryPending {
+			next = delivery.NextAttemptAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{delivery.ID, delivery.Event.Type, delivery.Event.TokenID, delivery.Status, fmt.Sprint(len(delivery.Attempts)), next, lastError})
+	}
+	return writeTable(stdout, []string{"ID", "EVENT", "TOKEN", "STATUS", "ATTEMPTS", "NEXT ATTEMPT", "LAST ERROR"}, rows)
+}
+
+func retryWebhookDelivery(args []string) error {
+	fs, o := newFlagSet("webhooks retry")
+	if err := parse(fs, o, args, 2, "<webhook ID> <delivery ID>"); err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	_, err := o.client().RetryWebhookDelivery(ctx, fs.Arg(0), fs.Arg(1))
+	return err
+}
+
+func splitFlag(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func listOrAll(values []string) string {
+	if len(values) == 0 {
+		return "all"
+	}
+	return strings.Join(values, ",")
+}
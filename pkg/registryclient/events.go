@@ -0,0 +1,70 @@
+package registryclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// StreamEvents subscribes to the server-sent events of a network and calls handle for every event, resuming after
+// lastEventID unless it is 0. It returns once ctx is done, the server closes the stream or handle fails, together
+// with the ID of the last handled event to resume from.
+func (c *HTTPClient) StreamEvents(ctx context.Context, network string, lastEventID uint64, handle func(event *registry.Event) error) (uint64, error) {
+	req := c.client.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Accept", "text/event-stream")
+	if lastEventID != 0 {
+		req.SetHeader(registryhttp.LastEventIDHeader, strconv.FormatUint(lastEventID, 10))
+	}
+	resp, err := req.Get(registryhttp.APIv2Endpoint + registryhttp.RegistriesEndpoint + "/" + url.PathEscape(network) + registryhttp.EventsEndpoint)
+	if err != nil {
+		return lastEventID, errors.Wrap(err, "failed to execute streamEvents HTTP call")
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if !resp.IsSuccess() {
+		data, _ := io.ReadAll(body)
+		return lastEventID, errors.Newf("streamEvents HTTP call returns an error: %s", bodyErrorMessage(data, resp.Status()))
+	}
+
+	// only the id and data fields are used, the event type is part of the data
+	var data strings.Builder
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			event := &registry.Event{}
+			if err := json.Unmarshal([]byte(data.String()), event); err != nil {
+				return lastEventID, errors.Wrap(err, "failed to parse event")
+			}
+			data.Reset()
+			if err := handle(event); err != nil {
+				return lastEventID, err
+			}
+			lastEventID = event.ID
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return lastEventID, errors.Wrap(err, "failed to read event stream")
+	}
+	return lastEventID, ctx.Err()
+}
@@ -2,7 +2,11 @@ package registryclient
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
 
 	"github.com/cockroachdb/errors"
 	"github.com/go-resty/resty/v2"
@@ -13,6 +17,8 @@ import (
 
 type HTTPClient struct {
 	client *resty.Client
+	// snapshotKey defines the public key snapshots are verified with.
+	snapshotKey ed25519.PublicKey
 }
 
 func NewHTTPClient(restyClient *resty.Client) *HTTPClient {
@@ -23,43 +29,63 @@ func (c *HTTPClient) SaveToken(ctx context.Context, network string, token *regis
 	resp, err := c.client.R().
 		SetContext(ctx).
 		SetBody(token).
-		SetError(&registryhttp.ErrorResponse{}).
-		Post(registryhttp.RegistriesEndpoint + "/" + network + registryhttp.TokensEndpoint)
+		Post(tokensPath(network))
 	if err != nil {
 		return errors.Wrap(err, "failed to execute saveAssets HTTP call")
 	}
 	if resp.IsSuccess() {
 		return nil
 	}
-	errorResp := resp.Error().(*registryhttp.ErrorResponse)
-	return errors.Newf("saveAssets HTTP call returns an error: %s", errorResp.Error)
+	return errors.Newf("saveAssets HTTP call returns an error: %s", errorMessage(resp))
 }
 
-func (c *HTTPClient) LoadTokens(ctx context.Context, network string, assets ...string) error {
-	assetID := ""
+// ValidateToken runs the registration checks on a token without saving it.
+func (c *HTTPClient) ValidateToken(ctx context.Context, network string, token *registry.IRC30Token) (*registryhttp.ValidationResponse, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(token).
+		Post(tokensPath(network) + registryhttp.ValidateEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute validateToken HTTP call")
+	}
+	if resp.IsSuccess() {
+		validation := &registryhttp.ValidationResponse{}
+		if parseErr := json.Unmarshal(resp.Body(), validation); parseErr != nil {
+			return nil, errors.Errorf("failed to parse validation in response body: %w", parseErr)
+		}
+		return validation, nil
+	}
+	return nil, errors.Newf("validateToken HTTP call returns an error: %s", errorMessage(resp))
+}
+
+func (c *HTTPClient) LoadTokens(ctx context.Context, network string, assets ...string) ([]*registry.IRC30Token, error) {
 	if len(assets) > 0 {
-		assetID = "/" + assets[0]
+		token, err := c.LoadToken(ctx, network, assets[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*registry.IRC30Token{token}, nil
 	}
 	resp, err := c.client.R().
 		SetContext(ctx).
-		SetError(&registryhttp.ErrorResponse{}).
-		Get(registryhttp.RegistriesEndpoint + "/" + network + registryhttp.TokensEndpoint + assetID)
+		Get(tokensPath(network))
 	if err != nil {
-		return errors.Wrap(err, "failed to execute loadAssets HTTP call")
+		return nil, errors.Wrap(err, "failed to execute loadAssets HTTP call")
 	}
 	if resp.IsSuccess() {
-		return nil
+		tokens := make([]*registry.IRC30Token, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &tokens); parseErr != nil {
+			return nil, errors.Errorf("failed to parse assets in response body: %w", parseErr)
+		}
+		return tokens, nil
 	}
-	errorResp := resp.Error().(*registryhttp.ErrorResponse)
-	return errors.Newf("loadAssets HTTP call returns an error: %s", errorResp.Error)
+	return nil, errors.Newf("loadAssets HTTP call returns an error: %s", errorMessage(resp))
 }
 
 func (c *HTTPClient) LoadToken(ctx context.Context, network string, asset string) (*registry.IRC30Token, error) {
-	assetID := "/" + asset
 	resp, err := c.client.R().
 		SetContext(ctx).
-		SetError(&registryhttp.ErrorResponse{}).
-		Get(registryhttp.RegistriesEndpoint + "/" + network + registryhttp.TokensEndpoint + assetID)
+		Get(tokensPath(network) + "/" + url.PathEscape(asset))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to execute loadAssets HTTP call")
 	}
@@ -71,6 +97,254 @@ func (c *HTTPClient) LoadToken(ctx context.Context, network string, asset string
 		}
 		return assetStruct, nil
 	}
-	errorResp := resp.Error().(*registryhttp.ErrorResponse)
-	return nil, errors.Newf("loadAsset HTTP call returns an error: %s", errorResp.Error)
+	return nil, errors.Newf("loadAsset HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadTokenList loads the tokens of a network in the token-list format.
+func (c *HTTPClient) LoadTokenList(ctx context.Context, network string) (*registryhttp.TokenList, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.APIv2Endpoint + registryhttp.RegistriesEndpoint + "/" + url.PathEscape(network) + registryhttp.TokenListEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadTokenList HTTP call")
+	}
+	if resp.IsSuccess() {
+		tokenList := &registryhttp.TokenList{}
+		if parseErr := json.Unmarshal(resp.Body(), tokenList); parseErr != nil {
+			return nil, errors.Errorf("failed to parse token list in response body: %w", parseErr)
+		}
+		return tokenList, nil
+	}
+	return nil, errors.Newf("loadTokenList HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadLogo loads the decoded logo of a token and its content type. A non-zero size requests a PNG thumbnail
+// of a raster logo.
+func (c *HTTPClient) LoadLogo(ctx context.Context, network string, asset string, size int) ([]byte, string, error) {
+	req := c.client.R().SetContext(ctx)
+	if size > 0 {
+		req.SetQueryParam("size", strconv.Itoa(size))
+	}
+	resp, err := req.Get(tokensPath(network) + "/" + url.PathEscape(asset) + registryhttp.LogoEndpoint)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to execute loadLogo HTTP call")
+	}
+	if resp.IsSuccess() {
+		return resp.Body(), resp.Header().Get("Content-Type"), nil
+	}
+	return nil, "", errors.Newf("loadLogo HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadPinnedLogo loads a logo pinned by the registry by its hash and its content type.
+func (c *HTTPClient) LoadPinnedLogo(ctx context.Context, hash string) ([]byte, string, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.LogosEndpoint + "/" + url.PathEscape(hash))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to execute loadPinnedLogo HTTP call")
+	}
+	if resp.IsSuccess() {
+		return resp.Body(), resp.Header().Get("Content-Type"), nil
+	}
+	return nil, "", errors.Newf("loadPinnedLogo HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// DeleteTokenByID deletes a token by its ID. It requires admin credentials on the underlying client.
+func (c *HTTPClient) DeleteTokenByID(ctx context.Context, network string, ID string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint + registryhttp.ByIDEndpoint + "/" + url.PathEscape(ID))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute deleteTokenByID HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("deleteTokenByID HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// DeleteTokenByName deletes all tokens with the given name. It requires admin credentials on the underlying client.
+func (c *HTTPClient) DeleteTokenByName(ctx context.Context, network string, name string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint + registryhttp.ByNameEndpoint + "/" + url.PathEscape(name))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute deleteTokenByName HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("deleteTokenByName HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadFilter returns the words of the swear filter. It requires admin credentials on the underlying client.
+func (c *HTTPClient) LoadFilter(ctx context.Context) ([]string, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.AdminEndpoint + registryhttp.FiltersEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadFilter HTTP call")
+	}
+	if resp.IsSuccess() {
+		words := make([]string, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &words); parseErr != nil {
+			return nil, errors.Errorf("failed to parse filter in response body: %w", parseErr)
+		}
+		return words, nil
+	}
+	return nil, errors.Newf("loadFilter HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// AddFilter adds a word to the swear filter. It requires admin credentials on the underlying client.
+func (c *HTTPClient) AddFilter(ctx context.Context, word string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Post(registryhttp.AdminEndpoint + registryhttp.FiltersEndpoint + "/" + url.PathEscape(word))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute addFilter HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("addFilter HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// DeleteFilter removes a word from the swear filter. It requires admin credentials on the underlying client.
+func (c *HTTPClient) DeleteFilter(ctx context.Context, word string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(registryhttp.AdminEndpoint + registryhttp.FiltersEndpoint + "/" + url.PathEscape(word))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute deleteFilter HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("deleteFilter HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadNetworks returns the networks known to the registry and whether they are enabled.
+func (c *HTTPClient) LoadNetworks(ctx context.Context) (map[string]bool, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.RegistriesEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadNetworks HTTP call")
+	}
+	if resp.IsSuccess() {
+		networks := make(map[string]bool)
+		if parseErr := json.Unmarshal(resp.Body(), &networks); parseErr != nil {
+			return nil, errors.Errorf("failed to parse networks in response body: %w", parseErr)
+		}
+		return networks, nil
+	}
+	return nil, errors.Newf("loadNetworks HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// SetNetwork enables or disables a network. It requires admin credentials on the underlying client.
+func (c *HTTPClient) SetNetwork(ctx context.Context, network string, enabled bool) error {
+	req := c.client.R().SetContext(ctx)
+	path := registryhttp.AdminEndpoint + registryhttp.NetworksEndpoint + "/" + url.PathEscape(network)
+
+	var resp *resty.Response
+	var err error
+	if enabled {
+		resp, err = req.Post(path)
+	} else {
+		resp, err = req.Delete(path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to execute setNetwork HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("setNetwork HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// ImportOptions defines how ImportTokens treats the imported tokens.
+type ImportOptions struct {
+	// Conflict defines what happens to tokens with the ID of a registered one: skip, overwrite or fail.
+	Conflict string
+	// DryRun reports what the import would do without writing anything.
+	DryRun bool
+	// Verify verifies every imported token against the node again.
+	Verify bool
+}
+
+// ExportTokens writes the token records of a network, including the fields set by the registry, as JSON Lines to w.
+// It requires admin credentials on the underlying client.
+func (c *HTTPClient) ExportTokens(ctx context.Context, network string, w io.Writer) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint + registryhttp.ExportEndpoint)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute exportTokens HTTP call")
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if !resp.IsSuccess() {
+		data, _ := io.ReadAll(body)
+		return errors.Newf("exportTokens HTTP call returns an error: %s", bodyErrorMessage(data, resp.Status()))
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return errors.Wrap(err, "failed to read export")
+	}
+	return nil
+}
+
+// ImportTokens imports token records from JSON Lines into a network. If any line fails, nothing is imported and
+// the response reporting the failed lines is returned with the error. It requires admin credentials on the
+// underlying client.
+func (c *HTTPClient) ImportTokens(ctx context.Context, network string, records io.Reader, options *ImportOptions) (*registryhttp.ImportResponse, error) {
+	req := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(records).
+		SetQueryParam("dryRun", strconv.FormatBool(options.DryRun)).
+		SetQueryParam("verify", strconv.FormatBool(options.Verify))
+	if options.Conflict != "" {
+		req.SetQueryParam("conflict", options.Conflict)
+	}
+	resp, err := req.Post(registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint + registryhttp.ImportEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute importTokens HTTP call")
+	}
+	response := &registryhttp.ImportResponse{}
+	if parseErr := json.Unmarshal(resp.Body(), response); parseErr != nil || response.Results == nil {
+		if resp.IsSuccess() {
+			return nil, errors.Errorf("failed to parse import in response body: %w", parseErr)
+		}
+		return nil, errors.Newf("importTokens HTTP call returns an error: %s", errorMessage(resp))
+	}
+	if !resp.IsSuccess() {
+		return response, errors.Newf("%d of %d lines failed, nothing was imported", response.Failed, len(response.Results))
+	}
+	return response, nil
+}
+
+func tokensPath(network string) string {
+	return registryhttp.RegistriesEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint
+}
+
+// errorMessage extracts the error message of a failed response. The server answers either with an
+// ErrorResponse, a plain JSON string or a text body, depending on where the request failed.
+func errorMessage(resp *resty.Response) string {
+	return bodyErrorMessage(resp.Body(), resp.Status())
+}
+
+func bodyErrorMessage(body []byte, status string) string {
+	errorResp := &registryhttp.ErrorResponse{}
+	if err := json.Unmarshal(body, errorResp); err == nil && errorResp.Error != "" {
+		return errorResp.Error
+	}
+	var message string
+	if err := json.Unmarshal(body, &message); err == nil {
+		return message
+	}
+	if len(body) > 0 {
+		return string(body)
+	}
+	return status
 }
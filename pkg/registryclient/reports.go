@@ -0,0 +1,88 @@
+package registryclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// ReportToken reports a token to the registry admins, e.g. as an impersonation or a scam.
+func (c *HTTPClient) ReportToken(ctx context.Context, network string, ID string, req *registryhttp.CreateReportRequest) (*registryhttp.CreateReportResponse, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(req).
+		Post(registryhttp.APIv2Endpoint + tokensPath(network) + "/" + url.PathEscape(ID) + registryhttp.ReportsEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute reportToken HTTP call")
+	}
+	if resp.IsSuccess() {
+		created := &registryhttp.CreateReportResponse{}
+		if parseErr := json.Unmarshal(resp.Body(), created); parseErr != nil {
+			return nil, errors.Errorf("failed to parse report in response body: %w", parseErr)
+		}
+		return created, nil
+	}
+	return nil, errors.Newf("reportToken HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadReports returns the latest reports grouped by token, only those of network unless it is empty, with status,
+// open if empty, and at most limit unless it is 0. It requires admin credentials on the underlying client.
+func (c *HTTPClient) LoadReports(ctx context.Context, network string, status string, limit int) ([]*registryhttp.ReportGroup, error) {
+	req := c.client.R().SetContext(ctx)
+	if network != "" {
+		req.SetQueryParam("network", network)
+	}
+	if status != "" {
+		req.SetQueryParam("status", status)
+	}
+	if limit != 0 {
+		req.SetQueryParam("limit", strconv.Itoa(limit))
+	}
+	resp, err := req.Get(registryhttp.AdminEndpoint + registryhttp.ReportsEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadReports HTTP call")
+	}
+	if resp.IsSuccess() {
+		groups := make([]*registryhttp.ReportGroup, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &groups); parseErr != nil {
+			return nil, errors.Errorf("failed to parse reports in response body: %w", parseErr)
+		}
+		return groups, nil
+	}
+	return nil, errors.Newf("loadReports HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// ResolveReport confirms a report and flags or removes the token, depending on the action, or leaves it as is. It
+// requires admin credentials on the underlying client.
+func (c *HTTPClient) ResolveReport(ctx context.Context, ID string, action string, note string) (*registry.Report, error) {
+	return c.triageReport(ctx, "resolveReport", ID, registryhttp.ResolveEndpoint, &registryhttp.ResolveReportRequest{Action: action, Note: note})
+}
+
+// DismissReport rejects a report, leaving the token as is. It requires admin credentials on the underlying client.
+func (c *HTTPClient) DismissReport(ctx context.Context, ID string, note string) (*registry.Report, error) {
+	return c.triageReport(ctx, "dismissReport", ID, registryhttp.DismissEndpoint, &registryhttp.ResolveReportRequest{Note: note})
+}
+
+func (c *HTTPClient) triageReport(ctx context.Context, call string, ID string, endpoint string, req *registryhttp.ResolveReportRequest) (*registry.Report, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(req).
+		Post(registryhttp.AdminEndpoint + registryhttp.ReportsEndpoint + "/" + url.PathEscape(ID) + endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to execute %s HTTP call", call)
+	}
+	if resp.IsSuccess() {
+		report := &registry.Report{}
+		if parseErr := json.Unmarshal(resp.Body(), report); parseErr != nil {
+			return nil, errors.Errorf("failed to parse report in response body: %w", parseErr)
+		}
+		return report, nil
+	}
+	return nil, errors.Newf("%s HTTP call returns an error: %s", call, errorMessage(resp))
+}
@@ -0,0 +1,176 @@
+package registryclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+var (
+	// ErrInvalidSignature is returned if a snapshot or Merkle root was not signed by the pinned key or was modified.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInvalidProof is returned if a token is not included in a Merkle root.
+	ErrInvalidProof = errors.New("invalid inclusion proof")
+)
+
+// ParsePublicKey parses a hex encoded Ed25519 public key, as served with the snapshots.
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode public key")
+	}
+	if len(keyBytes) != ed25519.PublicKeySize {
+		return nil, errors.Newf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(keyBytes))
+	}
+	return keyBytes, nil
+}
+
+// VerifySnapshot checks that snapshot was signed with publicKey and returns its content. It works offline, e.g. on a
+// copy of a snapshot shipped with a wallet.
+func VerifySnapshot(snapshot *registryhttp.SignedSnapshot, publicKey ed25519.PublicKey) (*registryhttp.SnapshotContent, error) {
+	data, err := verifySignature(snapshot.Snapshot, snapshot.Algorithm, snapshot.Signature, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	content := &registryhttp.SnapshotContent{}
+	if err := json.Unmarshal(data, content); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot")
+	}
+	return content, nil
+}
+
+// VerifyRoot checks that root was signed with publicKey and returns the Merkle root.
+func VerifyRoot(root *registryhttp.SignedRoot, publicKey ed25519.PublicKey) (*registryhttp.MerkleRoot, error) {
+	data, err := verifySignature(root.Root, root.Algorithm, root.Signature, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	merkleRoot := &registryhttp.MerkleRoot{}
+	if err := json.Unmarshal(data, merkleRoot); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Merkle root")
+	}
+	return merkleRoot, nil
+}
+
+// VerifyInclusion checks that token, with the proof steps, hashes to the trusted hex encoded Merkle root.
+func VerifyInclusion(token *registry.IRC30Token, steps []*registryhttp.ProofStep, root string) error {
+	rootBytes, err := hex.DecodeString(root)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode Merkle root")
+	}
+	leaf, err := registryhttp.TokenLeafHash(token)
+	if err != nil {
+		return err
+	}
+	ok, err := registryhttp.VerifyProof(leaf, steps, rootBytes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// verifySignature checks the signature of the canonical JSON of data and returns the canonical JSON.
+func verifySignature(data json.RawMessage, algorithm string, signature string, publicKey ed25519.PublicKey) ([]byte, error) {
+	if algorithm != registryhttp.SnapshotAlgorithm {
+		return nil, errors.Newf("unsupported signature algorithm %q", algorithm)
+	}
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode signature")
+	}
+	canonical, err := registryhttp.CanonicalJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to canonicalize signed data")
+	}
+	if !ed25519.Verify(publicKey, canonical, signatureBytes) {
+		return nil, ErrInvalidSignature
+	}
+	return canonical, nil
+}
+
+// SetSnapshotKey pins the public key the snapshots and Merkle roots are verified with.
+func (c *HTTPClient) SetSnapshotKey(publicKey ed25519.PublicKey) *HTTPClient {
+	c.snapshotKey = publicKey
+	return c
+}
+
+// LoadSnapshot loads a snapshot of a network, the latest one if sequence is 0, and verifies it against the key
+// pinned with SetSnapshotKey. The signed snapshot is returned as well, so it can be stored and verified again later.
+func (c *HTTPClient) LoadSnapshot(ctx context.Context, network string, sequence uint64) (*registryhttp.SignedSnapshot, *registryhttp.SnapshotContent, error) {
+	if c.snapshotKey == nil {
+		return nil, nil, errors.New("no snapshot key pinned, see SetSnapshotKey")
+	}
+	path := registryhttp.APIv2Endpoint + registryhttp.RegistriesEndpoint + "/" + url.PathEscape(network) + registryhttp.SnapshotsEndpoint
+	if sequence == 0 {
+		path += registryhttp.LatestEndpoint
+	} else {
+		path += "/" + strconv.FormatUint(sequence, 10)
+	}
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to execute loadSnapshot HTTP call")
+	}
+	if !resp.IsSuccess() {
+		return nil, nil, errors.Newf("loadSnapshot HTTP call returns an error: %s", errorMessage(resp))
+	}
+	snapshot := &registryhttp.SignedSnapshot{}
+	if parseErr := json.Unmarshal(resp.Body(), snapshot); parseErr != nil {
+		return nil, nil, errors.Errorf("failed to parse snapshot in response body: %w", parseErr)
+	}
+	content, err := VerifySnapshot(snapshot, c.snapshotKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.Network != network || (sequence != 0 && content.Sequence != sequence) {
+		return nil, nil, errors.Newf("registry returned snapshot %d of %s instead", content.Sequence, content.Network)
+	}
+	return snapshot, content, nil
+}
+
+// LoadProof loads a token with its inclusion proof in the latest snapshot of a network and verifies both the proof and
+// the Merkle root against the key pinned with SetSnapshotKey. It returns the proven token and the root.
+func (c *HTTPClient) LoadProof(ctx context.Context, network string, ID string) (*registry.IRC30Token, *registryhttp.MerkleRoot, error) {
+	if c.snapshotKey == nil {
+		return nil, nil, errors.New("no snapshot key pinned, see SetSnapshotKey")
+	}
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.APIv2Endpoint + tokensPath(network) + "/" + url.PathEscape(ID) + registryhttp.ProofEndpoint)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to execute loadProof HTTP call")
+	}
+	if !resp.IsSuccess() {
+		return nil, nil, errors.Newf("loadProof HTTP call returns an error: %s", errorMessage(resp))
+	}
+	proof := &registryhttp.InclusionProof{}
+	if parseErr := json.Unmarshal(resp.Body(), proof); parseErr != nil {
+		return nil, nil, errors.Errorf("failed to parse proof in response body: %w", parseErr)
+	}
+	if proof.Token == nil || proof.Root == nil {
+		return nil, nil, errors.New("proof lacks the token or the Merkle root")
+	}
+	root, err := VerifyRoot(proof.Root, c.snapshotKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.Network != network || proof.Token.ID != ID {
+		return nil, nil, errors.Newf("registry returned a proof of %s in %s instead", proof.Token.ID, root.Network)
+	}
+	if err := VerifyInclusion(proof.Token, proof.Steps, root.Root); err != nil {
+		return nil, nil, err
+	}
+	return proof.Token, root, nil
+}
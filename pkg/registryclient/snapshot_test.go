@@ -0,0 +1,157 @@
+package registryclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/go-resty/resty/v2"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func TestVerifySnapshot(t *testing.T) {
+	publicKey, privateKey := testKey(t, 1)
+	otherKey, _ := testKey(t, 2)
+	content := testSnapshotContent("alphanet", 3)
+	tests := []struct {
+		name      string
+		snapshot  *registryhttp.SignedSnapshot
+		key       ed25519.PublicKey
+		wantErr   error
+		wantOther bool
+	}{
+		{name: "valid", snapshot: signSnapshot(t, content, privateKey), key: publicKey},
+		{name: "reformatted", snapshot: reformat(signSnapshot(t, content, privateKey)), key: publicKey},
+		{name: "other key", snapshot: signSnapshot(t, content, privateKey), key: otherKey, wantErr: ErrInvalidSignature},
+		{name: "tampered token", snapshot: tamper(signSnapshot(t, content, privateKey), `"name":"One"`, `"name":"Two"`), key: publicKey, wantErr: ErrInvalidSignature},
+		{name: "tampered sequence", snapshot: tamper(signSnapshot(t, content, privateKey), `"sequence":3`, `"sequence":4`), key: publicKey, wantErr: ErrInvalidSignature},
+		{name: "unsupported algorithm", snapshot: func() *registryhttp.SignedSnapshot {
+			snapshot := signSnapshot(t, content, privateKey)
+			snapshot.Algorithm = "none"
+			return snapshot
+		}(), key: publicKey, wantOther: true},
+		{name: "invalid signature encoding", snapshot: func() *registryhttp.SignedSnapshot {
+			snapshot := signSnapshot(t, content, privateKey)
+			snapshot.Signature = "zz"
+			return snapshot
+		}(), key: publicKey, wantOther: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := VerifySnapshot(test.snapshot, test.key)
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("VerifySnapshot() error = %v, want %v", err, test.wantErr)
+				}
+			case test.wantOther:
+				if err == nil {
+					t.Error("VerifySnapshot() succeeded, want error")
+				}
+			case err != nil:
+				t.Errorf("VerifySnapshot() error = %v", err)
+			case got.Network != content.Network || got.Sequence != content.Sequence || len(got.Tokens) != 1:
+				t.Errorf("VerifySnapshot() = %+v, want %+v", got, content)
+			}
+		})
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	publicKey, privateKey := testKey(t, 1)
+	tests := []struct {
+		name     string
+		network  string
+		sequence uint64
+		served   *registryhttp.SignedSnapshot
+		wantPath string
+		wantErr  bool
+	}{
+		{name: "latest", network: "alphanet", served: signSnapshot(t, testSnapshotContent("alphanet", 3), privateKey), wantPath: "/api/v2/registries/alphanet/snapshots/latest"},
+		{name: "sequence", network: "alphanet", sequence: 3, served: signSnapshot(t, testSnapshotContent("alphanet", 3), privateKey), wantPath: "/api/v2/registries/alphanet/snapshots/3"},
+		{name: "wrong sequence", network: "alphanet", sequence: 2, served: signSnapshot(t, testSnapshotContent("alphanet", 3), privateKey), wantPath: "/api/v2/registries/alphanet/snapshots/2", wantErr: true},
+		{name: "wrong network", network: "alphanet", served: signSnapshot(t, testSnapshotContent("shimmer", 3), privateKey), wantPath: "/api/v2/registries/alphanet/snapshots/latest", wantErr: true},
+		{name: "tampered", network: "alphanet", served: tamper(signSnapshot(t, testSnapshotContent("alphanet", 3), privateKey), `"symbol":"ONE"`, `"symbol":"TWO"`), wantPath: "/api/v2/registries/alphanet/snapshots/latest", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != test.wantPath {
+					t.Errorf("requested %s, want %s", r.URL.Path, test.wantPath)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(test.served)
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient(resty.New().SetHostURL(server.URL)).SetSnapshotKey(publicKey)
+			_, content, err := client.LoadSnapshot(context.Background(), test.network, test.sequence)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("LoadSnapshot() = %+v, %v, want error %v", content, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSnapshotWithoutKey(t *testing.T) {
+	if _, _, err := NewHTTPClient(resty.New()).LoadSnapshot(context.Background(), "alphanet", 0); err == nil {
+		t.Error("LoadSnapshot() succeeded without a pinned key")
+	}
+}
+
+func testKey(t *testing.T, seed byte) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	privateKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat(string(rune('a'+seed)), ed25519.SeedSize)))
+	return privateKey.Public().(ed25519.PublicKey), privateKey
+}
+
+func testSnapshotContent(network string, sequence uint64) *registryhttp.SnapshotContent {
+	return &registryhttp.SnapshotContent{
+		Network:   network,
+		Sequence:  sequence,
+		Timestamp: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+		Tokens:    []*registry.IRC30Token{{ID: "0x01", Name: "One", Symbol: "ONE"}},
+	}
+}
+
+// signSnapshot signs content the way the registry does.
+func signSnapshot(t *testing.T, content *registryhttp.SnapshotContent, privateKey ed25519.PrivateKey) *registryhttp.SignedSnapshot {
+	t.Helper()
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical, err := registryhttp.CanonicalJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &registryhttp.SignedSnapshot{
+		Snapshot:  canonical,
+		Algorithm: registryhttp.SnapshotAlgorithm,
+		PublicKey: hex.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(ed25519.Sign(privateKey, canonical)),
+	}
+}
+
+// reformat indents the signed snapshot, which keeps its canonical JSON.
+func reformat(snapshot *registryhttp.SignedSnapshot) *registryhttp.SignedSnapshot {
+	var content interface{}
+	json.Unmarshal(snapshot.Snapshot, &content)
+	snapshot.Snapshot, _ = json.MarshalIndent(content, "", "  ")
+	return snapshot
+}
+
+// tamper replaces original with forged in the signed snapshot, keeping its signature.
+func tamper(snapshot *registryhttp.SignedSnapshot, original string, forged string) *registryhttp.SignedSnapshot {
+	snapshot.Snapshot = json.RawMessage(strings.Replace(string(snapshot.Snapshot), original, forged, 1))
+	return snapshot
+}
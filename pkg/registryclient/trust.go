@@ -0,0 +1,106 @@
+package registryclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// LoadTrustedTokens returns the tokens of a network with at least the trust level minTrust, all tokens if it is
+// empty, in the v2 representation that carries their trust level and issuer badge.
+func (c *HTTPClient) LoadTrustedTokens(ctx context.Context, network string, minTrust string) ([]*registryhttp.TokenV2, error) {
+	req := c.client.R().SetContext(ctx)
+	if minTrust != "" {
+		req.SetQueryParam("minTrust", minTrust)
+	}
+	resp, err := req.Get(registryhttp.APIv2Endpoint + tokensPath(network))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadTrustedTokens HTTP call")
+	}
+	if resp.IsSuccess() {
+		tokens := make([]*registryhttp.TokenV2, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &tokens); parseErr != nil {
+			return nil, errors.Errorf("failed to parse tokens in response body: %w", parseErr)
+		}
+		return tokens, nil
+	}
+	return nil, errors.Newf("loadTrustedTokens HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// SetTrustLevel assigns a trust level to a token, an empty level derives it from the checks again. It requires admin
+// credentials on the underlying client.
+func (c *HTTPClient) SetTrustLevel(ctx context.Context, network string, ID string, level string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(&registryhttp.SetTrustLevelRequest{TrustLevel: level}).
+		Post(registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.TokensEndpoint + registryhttp.ByIDEndpoint + "/" + url.PathEscape(ID) + registryhttp.TrustEndpoint)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute setTrustLevel HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("setTrustLevel HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadVerifiedIssuers returns the verified issuer aliases of a network. It requires admin credentials on the
+// underlying client.
+func (c *HTTPClient) LoadVerifiedIssuers(ctx context.Context, network string) ([]*registry.VerifiedIssuer, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(issuersPath(network))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadVerifiedIssuers HTTP call")
+	}
+	if resp.IsSuccess() {
+		issuers := make([]*registry.VerifiedIssuer, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &issuers); parseErr != nil {
+			return nil, errors.Errorf("failed to parse issuers in response body: %w", parseErr)
+		}
+		return issuers, nil
+	}
+	return nil, errors.Newf("loadVerifiedIssuers HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// VerifyIssuer marks an issuer alias as verified, so its tokens carry the verified-issuer badge. It requires admin
+// credentials on the underlying client.
+func (c *HTTPClient) VerifyIssuer(ctx context.Context, network string, aliasID string, req *registryhttp.VerifyIssuerRequest) (*registry.VerifiedIssuer, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(req).
+		Post(issuersPath(network) + "/" + url.PathEscape(aliasID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute verifyIssuer HTTP call")
+	}
+	if resp.IsSuccess() {
+		issuer := &registry.VerifiedIssuer{}
+		if parseErr := json.Unmarshal(resp.Body(), issuer); parseErr != nil {
+			return nil, errors.Errorf("failed to parse issuer in response body: %w", parseErr)
+		}
+		return issuer, nil
+	}
+	return nil, errors.Newf("verifyIssuer HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// UnverifyIssuer removes the verification of an issuer alias. It requires admin credentials on the underlying client.
+func (c *HTTPClient) UnverifyIssuer(ctx context.Context, network string, aliasID string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(issuersPath(network) + "/" + url.PathEscape(aliasID))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute unverifyIssuer HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("unverifyIssuer HTTP call returns an error: %s", errorMessage(resp))
+}
+
+func issuersPath(network string) string {
+	return registryhttp.AdminEndpoint + "/" + url.PathEscape(network) + registryhttp.IssuersEndpoint
+}
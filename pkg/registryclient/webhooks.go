@@ -0,0 +1,150 @@
+package registryclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// VerifyWebhookSignature checks the WebhookSignatureHeader of a webhook payload against the webhook secret, as
+// receivers of webhooks should before trusting the payload. Payloads signed longer than tolerance ago are rejected
+// to prevent replays, a tolerance of 0 accepts any age.
+func VerifyWebhookSignature(secret string, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+		switch strings.TrimSpace(key) {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.Wrap(ErrInvalidSignature, "invalid signature timestamp")
+			}
+			timestamp = parsed
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return errors.Wrap(ErrInvalidSignature, "malformed signature header")
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return errors.Wrap(ErrInvalidSignature, "signature expired")
+	}
+	expected := registryhttp.WebhookSignature(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte("t="+strconv.FormatInt(timestamp, 10)+",v1="+signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// LoadWebhooks returns the webhooks. It requires admin credentials on the underlying client.
+func (c *HTTPClient) LoadWebhooks(ctx context.Context) ([]*registry.Webhook, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(registryhttp.AdminEndpoint + registryhttp.WebhooksEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadWebhooks HTTP call")
+	}
+	if resp.IsSuccess() {
+		webhooks := make([]*registry.Webhook, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &webhooks); parseErr != nil {
+			return nil, errors.Errorf("failed to parse webhooks in response body: %w", parseErr)
+		}
+		return webhooks, nil
+	}
+	return nil, errors.Newf("loadWebhooks HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// CreateWebhook creates a webhook and returns it with its signing secret, which can not be retrieved later. It
+// requires admin credentials on the underlying client.
+func (c *HTTPClient) CreateWebhook(ctx context.Context, req *registryhttp.CreateWebhookRequest) (*registryhttp.CreateWebhookResponse, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(req).
+		Post(registryhttp.AdminEndpoint + registryhttp.WebhooksEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute createWebhook HTTP call")
+	}
+	if resp.IsSuccess() {
+		created := &registryhttp.CreateWebhookResponse{}
+		if parseErr := json.Unmarshal(resp.Body(), created); parseErr != nil {
+			return nil, errors.Errorf("failed to parse webhook in response body: %w", parseErr)
+		}
+		return created, nil
+	}
+	return nil, errors.Newf("createWebhook HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// DeleteWebhook deletes a webhook with its delivery log. It requires admin credentials on the underlying client.
+func (c *HTTPClient) DeleteWebhook(ctx context.Context, ID string) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(webhookPath(ID))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute deleteWebhook HTTP call")
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return errors.Newf("deleteWebhook HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// LoadWebhookDeliveries returns the latest deliveries of a webhook, newest first, only those with status unless it
+// is empty and at most limit unless it is 0. It requires admin credentials on the underlying client.
+func (c *HTTPClient) LoadWebhookDeliveries(ctx context.Context, ID string, status string, limit int) ([]*registry.WebhookDelivery, error) {
+	req := c.client.R().SetContext(ctx)
+	if status != "" {
+		req.SetQueryParam("status", status)
+	}
+	if limit != 0 {
+		req.SetQueryParam("limit", strconv.Itoa(limit))
+	}
+	resp, err := req.Get(webhookPath(ID) + registryhttp.DeliveriesEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute loadWebhookDeliveries HTTP call")
+	}
+	if resp.IsSuccess() {
+		deliveries := make([]*registry.WebhookDelivery, 0)
+		if parseErr := json.Unmarshal(resp.Body(), &deliveries); parseErr != nil {
+			return nil, errors.Errorf("failed to parse deliveries in response body: %w", parseErr)
+		}
+		return deliveries, nil
+	}
+	return nil, errors.Newf("loadWebhookDeliveries HTTP call returns an error: %s", errorMessage(resp))
+}
+
+// RetryWebhookDelivery queues a pending or failed delivery for another attempt right away. It requires admin
+// credentials on the underlying client.
+func (c *HTTPClient) RetryWebhookDelivery(ctx context.Context, ID string, deliveryID string) (*registry.WebhookDelivery, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Post(webhookPath(ID) + registryhttp.DeliveriesEndpoint + "/" + url.PathEscape(deliveryID) + registryhttp.RetryEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute retryWebhookDelivery HTTP call")
+	}
+	if resp.IsSuccess() {
+		delivery := &registry.WebhookDelivery{}
+		if parseErr := json.Unmarshal(resp.Body(), delivery); parseErr != nil {
+			return nil, errors.Errorf("failed to parse delivery in response body: %w", parseErr)
+		}
+		return delivery, nil
+	}
+	return nil, errors.Newf("retryWebhookDelivery HTTP call returns an error: %s", errorMessage(resp))
+}
+
+func webhookPath(ID string) string {
+	return registryhttp.AdminEndpoint + registryhttp.WebhooksEndpoint + "/" + url.PathEscape(ID)
+}
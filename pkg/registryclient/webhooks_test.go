@@ -0,0 +1,49 @@
+package registryclient
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"type":"token.registered"}`)
+	now := time.Now().Unix()
+	signed := registryhttp.WebhookSignature("secret", now, body)
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		wantErr   bool
+	}{
+		{name: "valid", secret: "secret", header: signed, body: body, tolerance: time.Minute},
+		{name: "spaces between parts", secret: "secret", header: strings.Replace(signed, ",", ", ", 1), body: body, tolerance: time.Minute},
+		{name: "wrong secret", secret: "other", header: signed, body: body, tolerance: time.Minute, wantErr: true},
+		{name: "modified body", secret: "secret", header: signed, body: []byte(`{"type":"token.deleted"}`), tolerance: time.Minute, wantErr: true},
+		{name: "modified timestamp", secret: "secret", header: strings.Replace(signed, "t="+strconv.FormatInt(now, 10), "t="+strconv.FormatInt(now+1, 10), 1), body: body, tolerance: time.Minute, wantErr: true},
+		{name: "expired", secret: "secret", header: registryhttp.WebhookSignature("secret", now-3600, body), body: body, tolerance: time.Minute, wantErr: true},
+		{name: "expired without tolerance", secret: "secret", header: registryhttp.WebhookSignature("secret", now-3600, body), body: body},
+		{name: "missing signature", secret: "secret", header: "t=" + strconv.FormatInt(now, 10), body: body, wantErr: true},
+		{name: "missing timestamp", secret: "secret", header: signed[strings.Index(signed, ",")+1:], body: body, wantErr: true},
+		{name: "invalid timestamp", secret: "secret", header: "t=now,v1=00", body: body, wantErr: true},
+		{name: "empty header", secret: "secret", body: body, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(test.secret, test.header, test.body, test.tolerance)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("VerifyWebhookSignature() error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifyWebhookSignature() error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
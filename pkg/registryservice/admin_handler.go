@@ -0,0 +1,161 @@
+package registryservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+const (
+	// defaultAuditLimit defines how many audit entries are returned if no limit is requested.
+	defaultAuditLimit = 100
+	// maxAuditLimit defines how many audit entries can be requested at most.
+	maxAuditLimit = 1000
+)
+
+// AdminHTTPHandler serves the management of admin accounts, API keys and the audit trail.
+type AdminHTTPHandler struct {
+	admins  registry.AdminService
+	auditor *Auditor
+}
+
+func NewAdminHTTPHandler(admins registry.AdminService, auditor *Auditor) *AdminHTTPHandler {
+	return &AdminHTTPHandler{admins: admins, auditor: auditor}
+}
+
+// WhoAmI describes the authenticated admin.
+func (h *AdminHTTPHandler) WhoAmI(c echo.Context) error {
+	identity := AdminIdentity(c)
+	return c.JSON(http.StatusOK, &registryhttp.IdentityResponse{Admin: identity.Admin, KeyID: identity.KeyID, Scopes: identity.Scopes})
+}
+
+func (h *AdminHTTPHandler) LoadAdmins(c echo.Context) error {
+	admins, err := h.admins.LoadAdmins(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load admins")))
+	}
+	return c.JSON(http.StatusOK, admins)
+}
+
+// CreateAdmin creates an admin account. Admins can only grant the scopes they have themselves.
+func (h *AdminHTTPHandler) CreateAdmin(c echo.Context) error {
+	ctx := c.Request().Context()
+	identity := AdminIdentity(c)
+	var req *registryhttp.CreateAdminRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "failed to parse request body as JSON into an admin")))
+	}
+	for _, scope := range req.Scopes {
+		if !identity.HasScope(scope) {
+			return c.JSON(http.StatusForbidden, errorResponse(c, errors.Newf("can not grant scope %s", scope)))
+		}
+	}
+	admin, err := NewAdmin(req.Name, req.Password, req.Scopes, identity.String())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	if err := h.admins.SaveAdmin(ctx, admin); err != nil {
+		if errors.Is(err, ErrAdminExists) {
+			return c.JSON(http.StatusConflict, errorResponse(c, err))
+		}
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save admin")))
+	}
+	h.auditor.Record(c, "createAdmin", "", admin.Name)
+	return c.JSON(http.StatusCreated, admin)
+}
+
+// DeleteAdmin deletes an admin account. Admins can only delete admins whose scopes they have themselves.
+func (h *AdminHTTPHandler) DeleteAdmin(c echo.Context) error {
+	ctx := c.Request().Context()
+	identity := AdminIdentity(c)
+	name := c.Param("name")
+	if name == identity.Admin {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("admins can not delete themselves")))
+	}
+	admin, err := h.admins.LoadAdmin(ctx, name)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load admin")))
+	}
+	for _, scope := range admin.Scopes {
+		if !identity.HasScope(scope) {
+			return c.JSON(http.StatusForbidden, errorResponse(c, errors.Newf("can not delete an admin with scope %s", scope)))
+		}
+	}
+	if err := h.admins.DeleteAdmin(ctx, name); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to delete admin")))
+	}
+	h.auditor.Record(c, "deleteAdmin", "", name)
+	return c.JSON(http.StatusOK, nil)
+}
+
+// LoadAPIKeys lists the API keys of the authenticated admin.
+func (h *AdminHTTPHandler) LoadAPIKeys(c echo.Context) error {
+	keys, err := h.admins.LoadAPIKeys(c.Request().Context(), AdminIdentity(c).Admin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load API keys")))
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey creates an API key for the authenticated admin, limited to a subset of its scopes.
+func (h *AdminHTTPHandler) CreateAPIKey(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req *registryhttp.CreateAPIKeyRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "failed to parse request body as JSON into an API key")))
+	}
+	admin, err := h.admins.LoadAdmin(ctx, AdminIdentity(c).Admin)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("only stored admin accounts can own API keys")))
+	}
+	apiKey, key, err := NewAPIKey(admin, req.Scopes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	if err := h.admins.SaveAPIKey(ctx, apiKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save API key")))
+	}
+	h.auditor.Record(c, "createAPIKey", "", apiKey.ID)
+	return c.JSON(http.StatusCreated, &registryhttp.CreateAPIKeyResponse{Key: key, APIKey: apiKey})
+}
+
+// DeleteAPIKey revokes an API key. Admins can revoke their own keys, the keys of others need the admins:admin scope.
+func (h *AdminHTTPHandler) DeleteAPIKey(c echo.Context) error {
+	ctx := c.Request().Context()
+	identity := AdminIdentity(c)
+	ID := c.Param("keyID")
+	apiKey, err := h.admins.LoadAPIKey(ctx, ID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load API key")))
+	}
+	if apiKey.Admin != identity.Admin && !identity.HasScope(ScopeAdminsAdmin) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, errors.New("can not revoke the API keys of other admins")))
+	}
+	if err := h.admins.DeleteAPIKey(ctx, ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to delete API key")))
+	}
+	h.auditor.Record(c, "deleteAPIKey", "", ID)
+	return c.JSON(http.StatusOK, nil)
+}
+
+// LoadAuditEntries returns the latest entries of the audit trail, newest first.
+func (h *AdminHTTPHandler) LoadAuditEntries(c echo.Context) error {
+	limit := int64(defaultAuditLimit)
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || parsed <= 0 || parsed > maxAuditLimit {
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("limit must be between 1 and %d", maxAuditLimit)))
+		}
+		limit = parsed
+	}
+	entries, err := h.admins.LoadAuditEntries(c.Request().Context(), limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load audit entries")))
+	}
+	return c.JSON(http.StatusOK, entries)
+}
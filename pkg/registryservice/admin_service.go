@@ -0,0 +1,96 @@
+package registryservice
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	adminsCollection  = "_admins"
+	apiKeysCollection = "_apiKeys"
+	auditCollection   = "_audit"
+)
+
+var ErrAdminExists = errors.New("admin already exists")
+
+func (s *Service) SaveAdmin(ctx context.Context, admin *registry.Admin) error {
+	_, err := s.db.Collection(adminsCollection).InsertOne(ctx, admin)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAdminExists
+	}
+	return errors.Wrap(err, "failed to insert admin into mongo collection")
+}
+
+func (s *Service) LoadAdmin(ctx context.Context, name string) (admin *registry.Admin, err error) {
+	// Query One
+	result := s.db.Collection(adminsCollection).FindOne(ctx, bson.M{"_id": name})
+	err = result.Decode(&admin)
+	return
+}
+
+func (s *Service) LoadAdmins(ctx context.Context) (admins []*registry.Admin, err error) {
+	admins = make([]*registry.Admin, 0)
+	cur, err := s.db.Collection(adminsCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &admins)
+	return
+}
+
+// DeleteAdmin deletes an admin together with its API keys.
+func (s *Service) DeleteAdmin(ctx context.Context, name string) (err error) {
+	if _, err = s.db.Collection(apiKeysCollection).DeleteMany(ctx, bson.M{"admin": name}); err != nil {
+		return
+	}
+	_, err = s.db.Collection(adminsCollection).DeleteOne(ctx, bson.M{"_id": name})
+	return
+}
+
+func (s *Service) SaveAPIKey(ctx context.Context, key *registry.APIKey) error {
+	_, err := s.db.Collection(apiKeysCollection).InsertOne(ctx, key)
+	return errors.Wrap(err, "failed to insert API key into mongo collection")
+}
+
+func (s *Service) LoadAPIKey(ctx context.Context, ID string) (key *registry.APIKey, err error) {
+	// Query One
+	result := s.db.Collection(apiKeysCollection).FindOne(ctx, bson.M{"_id": ID})
+	err = result.Decode(&key)
+	return
+}
+
+func (s *Service) LoadAPIKeys(ctx context.Context, admin string) (keys []*registry.APIKey, err error) {
+	keys = make([]*registry.APIKey, 0)
+	cur, err := s.db.Collection(apiKeysCollection).Find(ctx, bson.M{"admin": admin}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &keys)
+	return
+}
+
+func (s *Service) DeleteAPIKey(ctx context.Context, ID string) (err error) {
+	_, err = s.db.Collection(apiKeysCollection).DeleteOne(ctx, bson.M{"_id": ID})
+	return
+}
+
+func (s *Service) SaveAuditEntry(ctx context.Context, entry *registry.AuditEntry) error {
+	_, err := s.db.Collection(auditCollection).InsertOne(ctx, entry)
+	return errors.Wrap(err, "failed to insert audit entry into mongo collection")
+}
+
+// LoadAuditEntries loads the latest audit entries, newest first.
+func (s *Service) LoadAuditEntries(ctx context.Context, limit int64) (entries []*registry.AuditEntry, err error) {
+	entries = make([]*registry.AuditEntry, 0)
+	cur, err := s.db.Collection(auditCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"time": -1}).SetLimit(limit))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &entries)
+	return
+}
@@ -0,0 +1,341 @@
+package registryservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ScopeAll           = "*"
+	ScopeTokensDelete  = "tokens:delete"
+	ScopeTokensExport  = "tokens:export"
+	ScopeTokensImport  = "tokens:import"
+	ScopeFiltersRead   = "filters:read"
+	ScopeFiltersWrite  = "filters:write"
+	ScopeNetworksAdmin = "networks:admin"
+	ScopeAdminsAdmin   = "admins:admin"
+	ScopeWebhooksAdmin = "webhooks:admin"
+	ScopeReportsAdmin  = "reports:admin"
+	ScopeTrustAdmin    = "trust:admin"
+
+	// apiKeyPrefix marks API keys, which are formatted as tvk_<ID>_<secret>.
+	apiKeyPrefix = "tvk_"
+	// minPasswordLength defines the minimum length of admin passwords.
+	minPasswordLength = 12
+	// identityContextKey holds the authenticated admin identity in the echo context.
+	identityContextKey = "adminIdentity"
+)
+
+var (
+	// ErrInvalidCredentials is returned if a request carries no, unknown or wrong credentials.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// Scopes are the scopes admins and API keys can be granted.
+	Scopes = []string{ScopeAll, ScopeTokensDelete, ScopeTokensExport, ScopeTokensImport, ScopeFiltersRead, ScopeFiltersWrite, ScopeNetworksAdmin, ScopeAdminsAdmin, ScopeWebhooksAdmin, ScopeReportsAdmin, ScopeTrustAdmin}
+
+	adminNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+)
+
+// Identity defines an authenticated admin and the scopes granted to the request.
+type Identity struct {
+	// Admin defines the name of the admin.
+	Admin string
+	// KeyID defines the API key used, empty for basic auth.
+	KeyID string
+	// Scopes defines the scopes of the admin, or of the key if one was used.
+	Scopes []string
+}
+
+func (i *Identity) String() string {
+	if i.KeyID != "" {
+		return i.Admin + "/key:" + i.KeyID
+	}
+	return i.Admin
+}
+
+// HasScope tells whether the identity was granted scope.
+func (i *Identity) HasScope(scope string) bool {
+	return hasScope(i.Scopes, scope)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == ScopeAll || granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminIdentity returns the admin identity authenticated for the request, nil if there is none.
+func AdminIdentity(c echo.Context) *Identity {
+	identity, _ := c.Get(identityContextKey).(*Identity)
+	return identity
+}
+
+// Authenticator authenticates admins by basic auth or API key.
+type Authenticator struct {
+	admins registry.AdminService
+	// legacyUser and legacyPassword define the admin configured by flags, disabled if the password is empty.
+	legacyUser     string
+	legacyPassword string
+	// dummyHash is compared against for unknown admins, so they take as long to reject as wrong passwords.
+	dummyHash []byte
+}
+
+// NewAuthenticator creates a new authenticator. The legacy account has all scopes and is disabled if legacyPassword is empty.
+func NewAuthenticator(admins registry.AdminService, legacyUser string, legacyPassword string) *Authenticator {
+	secret, _ := randomString(16)
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	return &Authenticator{admins: admins, legacyUser: legacyUser, legacyPassword: legacyPassword, dummyHash: dummyHash}
+}
+
+// Middleware authenticates the request by an API key in the X-API-Key header or as bearer token, or by basic auth.
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			req := c.Request()
+
+			var identity *Identity
+			var err error
+			if key := apiKeyFromRequest(c); key != "" {
+				identity, err = a.authenticateKey(ctx, key)
+			} else if user, password, ok := req.BasicAuth(); ok {
+				identity, err = a.authenticatePassword(ctx, user, password)
+			} else {
+				err = ErrInvalidCredentials
+			}
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="admin"`)
+				return echo.ErrUnauthorized
+			case err != nil:
+				// a failure to load the credentials must not look like wrong ones
+				return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "failed to authenticate")))
+			}
+
+			c.Set(identityContextKey, identity)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects requests whose identity was not granted scope. It must run after Middleware.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			identity := AdminIdentity(c)
+			if identity == nil {
+				return echo.ErrUnauthorized
+			}
+			if !identity.HasScope(scope) {
+				return echo.ErrForbidden
+			}
+			return next(c)
+		}
+	}
+}
+
+func (a *Authenticator) authenticatePassword(ctx context.Context, user string, password string) (*Identity, error) {
+	// Be careful to use constant time comparison to prevent timing attacks
+	if a.legacyPassword != "" &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(a.legacyUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(a.legacyPassword)) == 1 {
+		return &Identity{Admin: a.legacyUser, Scopes: []string{ScopeAll}}, nil
+	}
+
+	admin, err := a.loadAdmin(ctx, user)
+	if err != nil {
+		// unknown admins are rejected only after a comparison, so the response time does not tell which names exist
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)); err != nil {
+		return nil, errors.Mark(err, ErrInvalidCredentials)
+	}
+	return &Identity{Admin: admin.Name, Scopes: admin.Scopes}, nil
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, key string) (*Identity, error) {
+	ID, secret, err := ParseAPIKey(key)
+	if err != nil {
+		return nil, errors.Mark(err, ErrInvalidCredentials)
+	}
+	apiKey, err := a.admins.LoadAPIKey(ctx, ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.Mark(err, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "service failed to load API key")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, errors.Wrap(ErrInvalidCredentials, "invalid API key")
+	}
+	// the key loses the scopes its admin lost since it was created
+	admin, err := a.loadAdmin(ctx, apiKey.Admin)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		if hasScope(admin.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &Identity{Admin: admin.Name, KeyID: apiKey.ID, Scopes: scopes}, nil
+}
+
+// loadAdmin loads an admin, unknown admins are invalid credentials.
+func (a *Authenticator) loadAdmin(ctx context.Context, name string) (*registry.Admin, error) {
+	admin, err := a.admins.LoadAdmin(ctx, name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.Mark(err, ErrInvalidCredentials)
+	}
+	return admin, errors.Wrap(err, "service failed to load admin")
+}
+
+func apiKeyFromRequest(c echo.Context) string {
+	if key := c.Request().Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return auth[7:]
+	}
+	return ""
+}
+
+// NewAdmin creates an admin with a hashed password after validating name, password and scopes.
+func NewAdmin(name string, password string, scopes []string, createdBy string) (*registry.Admin, error) {
+	if !adminNamePattern.MatchString(name) {
+		return nil, errors.Newf("invalid admin name %q", name)
+	}
+	if len(password) < minPasswordLength {
+		return nil, errors.Newf("admin password must have at least %d characters", minPasswordLength)
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash admin password")
+	}
+	return &registry.Admin{
+		Name:         name,
+		PasswordHash: string(hash),
+		Scopes:       scopes,
+		CreatedAt:    time.Now().UTC(),
+		CreatedBy:    createdBy,
+	}, nil
+}
+
+// NewAPIKey creates an API key for admin and returns it together with the key string, which is shown only once.
+func NewAPIKey(admin *registry.Admin, scopes []string) (*registry.APIKey, string, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+	for _, scope := range scopes {
+		if !hasScope(admin.Scopes, scope) {
+			return nil, "", errors.Newf("admin %s does not have scope %s", admin.Name, scope)
+		}
+	}
+	ID, err := randomString(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey := &registry.APIKey{
+		ID:         ID,
+		Admin:      admin.Name,
+		SecretHash: hashSecret(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now().UTC(),
+	}
+	return apiKey, apiKeyPrefix + ID + "_" + secret, nil
+}
+
+// ParseAPIKey splits an API key string into its ID and secret.
+func ParseAPIKey(key string) (ID string, secret string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("malformed API key")
+	}
+	return parts[0], parts[1], nil
+}
+
+// ValidateScopes checks that scopes is not empty and only holds known scopes.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range Scopes {
+			known = known || s == scope
+		}
+		if !known {
+			return errors.Newf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to read random bytes")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Auditor records admin actions in the log and the audit trail.
+type Auditor struct {
+	admins registry.AdminService
+}
+
+// NewAuditor creates a new auditor.
+func NewAuditor(admins registry.AdminService) *Auditor {
+	return &Auditor{admins: admins}
+}
+
+// Record records an action of the admin authenticated for the request. A failure to persist the entry is logged only,
+// as the action itself already happened.
+func (a *Auditor) Record(c echo.Context, action string, network string, target string) {
+	identity := "anonymous"
+	if i := AdminIdentity(c); i != nil {
+		identity = i.String()
+	}
+	entry := &registry.AuditEntry{
+		Time:     time.Now().UTC(),
+		Identity: identity,
+		Action:   action,
+		Network:  network,
+		Target:   target,
+	}
+	Logger(c).Infow("Admin action", "identity", entry.Identity, "action", action, "network", network, "target", target)
+	if err := a.admins.SaveAuditEntry(c.Request().Context(), entry); err != nil {
+		Logger(c).Warnw("Failed to save audit entry", "error", err, "action", action)
+	}
+}
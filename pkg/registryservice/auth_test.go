@@ -0,0 +1,94 @@
+package registryservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubCredentials holds a single admin and API key and fails every lookup with err if it is set.
+type stubCredentials struct {
+	registry.AdminService
+	admin  *registry.Admin
+	apiKey *registry.APIKey
+	err    error
+}
+
+func (s *stubCredentials) LoadAdmin(_ context.Context, name string) (*registry.Admin, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if name != s.admin.Name {
+		return nil, mongo.ErrNoDocuments
+	}
+	return s.admin, nil
+}
+
+func (s *stubCredentials) LoadAPIKey(_ context.Context, ID string) (*registry.APIKey, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if ID != s.apiKey.ID {
+		return nil, mongo.ErrNoDocuments
+	}
+	return s.apiKey, nil
+}
+
+func TestAuthenticatorMiddleware(t *testing.T) {
+	admin, err := NewAdmin("alice", "correct horse battery", []string{ScopeAll}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, key, err := NewAPIKey(admin, []string{ScopeFiltersRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		key        string
+		err        error
+		wantStatus int
+	}{
+		{name: "password", user: "alice", password: "correct horse battery", wantStatus: http.StatusOK},
+		{name: "wrong password", user: "alice", password: "wrong horse battery", wantStatus: http.StatusUnauthorized},
+		{name: "unknown admin", user: "bob", password: "correct horse battery", wantStatus: http.StatusUnauthorized},
+		{name: "API key", key: key, wantStatus: http.StatusOK},
+		{name: "wrong API key secret", key: apiKeyPrefix + apiKey.ID + "_wrong", wantStatus: http.StatusUnauthorized},
+		{name: "unknown API key", key: apiKeyPrefix + "unknown_secret", wantStatus: http.StatusUnauthorized},
+		{name: "malformed API key", key: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "no credentials", wantStatus: http.StatusUnauthorized},
+		{name: "admins unavailable", user: "alice", password: "correct horse battery", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+		{name: "API keys unavailable", key: key, err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := NewAuthenticator(&stubCredentials{admin: admin, apiKey: apiKey, err: test.err}, "admin", "")
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, auth.Middleware())
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.user != "" {
+				req.SetBasicAuth(test.user, test.password)
+			}
+			if test.key != "" {
+				req.Header.Set("X-API-Key", test.key)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			if challenged := rec.Header().Get(echo.HeaderWWWAuthenticate) != ""; challenged != (test.wantStatus == http.StatusUnauthorized) {
+				t.Errorf("WWW-Authenticate set = %v with status %d", challenged, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package registryservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	eventsCollection   = "_events"
+	countersCollection = "_counters"
+	// eventsCounter defines the counter the event IDs are assigned from.
+	eventsCounter = "events"
+
+	// eventBatchSize defines how many events are loaded at once.
+	eventBatchSize = 500
+	// eventBufferSize defines how many events may wait for a subscriber before it is dropped as too slow.
+	eventBufferSize = 256
+	// eventGapTimeout defines how long the feed waits for a missing event ID, which another instance assigned but
+	// did not insert yet, before it skips the ID.
+	eventGapTimeout = 5 * time.Second
+	// eventPruneInterval defines how often the events beyond the retention are deleted.
+	eventPruneInterval = time.Hour
+	// eventKeepAliveInterval defines how often idle streams are kept alive, so proxies do not close them.
+	eventKeepAliveInterval = 30 * time.Second
+	// eventWriteTimeout defines how long sending an event to a WebSocket client may take.
+	eventWriteTimeout = 10 * time.Second
+	// eventRetry defines how long browsers wait before reconnecting a closed EventSource.
+	eventRetry = 5 * time.Second
+	// eventPublishTimeout defines how long saving an event and notifying the listeners may take.
+	eventPublishTimeout = 10 * time.Second
+)
+
+var (
+	// ErrEventFeedStopped is returned to subscribers once the event feed is shut down.
+	ErrEventFeedStopped = errors.New("event feed stopped")
+	// errSubscriptionClosed is returned once a subscription is closed, as the feed stopped or the subscriber fell
+	// behind.
+	errSubscriptionClosed = errors.New("event subscription closed")
+)
+
+// SaveEvent assigns the next event ID to event and inserts it.
+func (s *Service) SaveEvent(ctx context.Context, event *registry.Event) error {
+	var counter struct {
+		Sequence uint64 `bson:"sequence"`
+	}
+	result := s.db.Collection(countersCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": eventsCounter},
+		bson.M{"$inc": bson.M{"sequence": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+	if err := result.Decode(&counter); err != nil {
+		return errors.Wrap(err, "failed to assign event ID")
+	}
+	event.ID = counter.Sequence
+	_, err := s.db.Collection(eventsCollection).InsertOne(ctx, event)
+	return errors.Wrap(err, "failed to insert event into mongo collection")
+}
+
+// LoadEvents loads up to limit events of a network with an ID greater than after, ordered by ID. An empty network
+// loads the events of all networks.
+func (s *Service) LoadEvents(ctx context.Context, network string, after uint64, limit int64) (events []*registry.Event, err error) {
+	filter := bson.M{"_id": bson.M{"$gt": after}}
+	if network != "" {
+		filter["network"] = network
+	}
+	events = make([]*registry.Event, 0)
+	cur, err := s.db.Collection(eventsCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &events)
+	return
+}
+
+// LoadLatestEventID loads the last event ID assigned, 0 if there is none.
+func (s *Service) LoadLatestEventID(ctx context.Context) (uint64, error) {
+	var counter struct {
+		Sequence uint64 `bson:"sequence"`
+	}
+	err := s.db.Collection(countersCollection).FindOne(ctx, bson.M{"_id": eventsCounter}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return counter.Sequence, err
+}
+
+// DeleteEvents deletes the events that happened before the given time.
+func (s *Service) DeleteEvents(ctx context.Context, before time.Time) (err error) {
+	_, err = s.db.Collection(eventsCollection).DeleteMany(ctx, bson.M{"time": bson.M{"$lt": before}})
+	return
+}
+
+// EventFeed pushes the changes of the registry to SSE and WebSocket subscribers. Every instance publishes the
+// changes it makes to the events collection and tails the collection, so the subscribers of each instance receive
+// the events of all of them. The collection is polled rather than watched with a change stream, which would require
+// MongoDB to run as a replica set.
+type EventFeed struct {
+	events       registry.EventService
+	pollInterval time.Duration
+	retention    time.Duration
+	upgrader     websocket.Upgrader
+	// listeners are called with every event this instance publishes.
+	listeners []func(ctx context.Context, event *registry.Event)
+	// wake makes the feed poll right away after this instance published an event.
+	wake chan struct{}
+	// ready is closed once the feed knows the last event ID, done once it stopped.
+	ready chan struct{}
+	done  chan struct{}
+	// gapSince defines since when the feed waits for a missing event ID.
+	gapSince time.Time
+
+	mutex sync.Mutex
+	// last defines the ID of the last event delivered to the subscribers.
+	last        uint64
+	stopped     bool
+	subscribers map[*eventSubscription]struct{}
+}
+
+type eventSubscription struct {
+	network string
+	events  chan *registry.Event
+}
+
+// NewEventFeed creates an event feed polling for new events every pollInterval and keeping them for retention, so
+// subscribers can resume. WebSocket connections are accepted from allowOrigins only, which may contain "*".
+func NewEventFeed(events registry.EventService, pollInterval time.Duration, retention time.Duration, allowOrigins []string) *EventFeed {
+	return &EventFeed{
+		events:       events,
+		pollInterval: pollInterval,
+		retention:    retention,
+		upgrader:     websocket.Upgrader{CheckOrigin: originChecker(allowOrigins)},
+		wake:         make(chan struct{}, 1),
+		ready:        make(chan struct{}),
+		done:         make(chan struct{}),
+		subscribers:  make(map[*eventSubscription]struct{}),
+	}
+}
+
+// OnPublish registers listener to be called with every event this instance publishes, once the event is stored. Each
+// event is published by a single instance, so listeners see it once across all of them. Listeners must be registered
+// before the feed is used.
+func (f *EventFeed) OnPublish(listener func(ctx context.Context, event *registry.Event)) {
+	f.listeners = append(f.listeners, listener)
+}
+
+// Publish records that a token changed. A failure is logged only, as the change itself already happened. The event
+// is saved even if ctx is cancelled, e.g. as the client of the request disconnected.
+func (f *EventFeed) Publish(ctx context.Context, eventType string, network string, token *registry.IRC30Token) {
+	ctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, eventPublishTimeout)
+	defer cancel()
+	event := &registry.Event{
+		Type:               eventType,
+		Network:            network,
+		TokenID:            token.ID,
+		Name:               token.Name,
+		Symbol:             token.Symbol,
+		VerificationStatus: token.VerificationStatus,
+		Flag:               token.Flag,
+		Time:               time.Now().UTC(),
+	}
+	if eventType != registryhttp.EventTokenVerification {
+		event.VerificationStatus = ""
+	}
+	if eventType != registryhttp.EventTokenFlagged {
+		event.Flag = nil
+	}
+	if err := f.events.SaveEvent(ctx, event); err != nil {
+		ContextLogger(ctx).Errorw("Failed to publish event", "type", eventType, "network", network, "token", token.ID, "error", err)
+		return
+	}
+	for _, listener := range f.listeners {
+		listener(ctx, event)
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// detachedContext keeps the values of its parent, e.g. the request logger, but neither its deadline nor its
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// Run delivers new events to the subscribers and prunes the old ones until ctx is cancelled, then closes every
+// subscription.
+func (f *EventFeed) Run(ctx context.Context) {
+	defer f.stop()
+	poll := time.NewTicker(f.pollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(eventPruneInterval)
+	defer prune.Stop()
+
+	// subscribers only receive the events published from now on, unless they resume from an earlier ID
+	for {
+		last, err := f.events.LoadLatestEventID(ctx)
+		if err == nil {
+			f.mutex.Lock()
+			f.last = last
+			f.mutex.Unlock()
+			close(f.ready)
+			break
+		}
+		ContextLogger(ctx).Warnw("Failed to load the latest event ID", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			f.poll(ctx)
+		case <-f.wake:
+			f.poll(ctx)
+		case now := <-prune.C:
+			if err := f.events.DeleteEvents(ctx, now.Add(-f.retention)); err != nil {
+				ContextLogger(ctx).Warnw("Failed to prune events", "error", err)
+			}
+		}
+	}
+}
+
+// poll delivers the events following the last delivered one. Events are delivered in the order of their IDs, a
+// missing ID holds back the following events until it is inserted or eventGapTimeout passes.
+func (f *EventFeed) poll(ctx context.Context) {
+	for {
+		events, err := f.events.LoadEvents(ctx, "", f.last, eventBatchSize)
+		if err != nil {
+			ContextLogger(ctx).Warnw("Failed to load events", "error", err)
+			return
+		}
+		for _, event := range events {
+			if event.ID != f.last+1 {
+				if f.gapSince.IsZero() {
+					f.gapSince = time.Now()
+				}
+				if time.Since(f.gapSince) < eventGapTimeout {
+					return
+				}
+				ContextLogger(ctx).Warnw("Skipping missing events", "from", f.last+1, "to", event.ID-1)
+			}
+			f.gapSince = time.Time{}
+			f.deliver(ctx, event)
+		}
+		if len(events) < eventBatchSize {
+			return
+		}
+	}
+}
+
+// deliver sends event to the subscribers of its network. Subscribers that fall behind are dropped, they resume from
+// the collection once they reconnect.
+func (f *EventFeed) deliver(ctx context.Context, event *registry.Event) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.last = event.ID
+	for subscription := range f.subscribers {
+		if subscription.network != event.Network {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			ContextLogger(ctx).Infow("Dropping slow event subscriber", "network", event.Network)
+			delete(f.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+func (f *EventFeed) stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stopped = true
+	for subscription := range f.subscribers {
+		delete(f.subscribers, subscription)
+		close(subscription.events)
+	}
+	close(f.done)
+}
+
+// subscribe subscribes to the events of network and returns the ID of the last event that was delivered before.
+func (f *EventFeed) subscribe(ctx context.Context, network string) (*eventSubscription, uint64, error) {
+	select {
+	case <-f.ready:
+	case <-f.done:
+		return nil, 0, ErrEventFeedStopped
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.stopped {
+		return nil, 0, ErrEventFeedStopped
+	}
+	subscription := &eventSubscription{network: network, events: make(chan *registry.Event, eventBufferSize)}
+	f.subscribers[subscription] = struct{}{}
+	return subscription, f.last, nil
+}
+
+func (f *EventFeed) unsubscribe(subscription *eventSubscription) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.subscribers[subscription]; ok {
+		delete(f.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// StreamEvents streams the events of a network over a WebSocket if the request asks for an upgrade, as server-sent
+// events otherwise. Clients resume after the event ID in the Last-Event-ID header or the lastEventId query parameter.
+func (f *EventFeed) StreamEvents(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	lastEventID := c.Request().Header.Get(registryhttp.LastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("lastEventId")
+	}
+	var after uint64
+	if lastEventID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid last event ID %q", lastEventID)))
+		}
+	}
+
+	subscription, last, err := f.subscribe(ctx, network)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, errorResponse(c, err))
+	}
+	defer f.unsubscribe(subscription)
+
+	if websocket.IsWebSocketUpgrade(c.Request()) {
+		return f.streamWebSocket(c, subscription, after, last)
+	}
+	return f.streamSSE(c, subscription, after, last)
+}
+
+func (f *EventFeed) streamSSE(c echo.Context, subscription *eventSubscription, after uint64, last uint64) error {
+	response := c.Response()
+	header := response.Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// keeps nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	fmt.Fprintf(response, "retry: %d\n\n", eventRetry.Milliseconds())
+	response.Flush()
+
+	send := func(event *registry.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(response, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		response.Flush()
+		return nil
+	}
+	keepAlive := func() error {
+		if _, err := fmt.Fprint(response, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		response.Flush()
+		return nil
+	}
+	if err := f.forward(c.Request().Context(), subscription, after, last, send, keepAlive); err != nil {
+		Logger(c).Debugw("Event stream closed", "error", err)
+	}
+	return nil
+}
+
+func (f *EventFeed) streamWebSocket(c echo.Context, subscription *eventSubscription, after uint64, last uint64) error {
+	conn, err := f.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader responded with the error already
+		Logger(c).Debugw("WebSocket upgrade failed", "error", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// the client sends nothing but control frames, reading them tells when it goes away
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	conn.SetReadLimit(512)
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event *registry.Event) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(event)
+	}
+	keepAlive := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout))
+	}
+	err = f.forward(ctx, subscription, after, last, send, keepAlive)
+	Logger(c).Debugw("Event stream closed", "error", err)
+	// clients whose subscription was closed resume with the ID of the last event they received
+	closeCode := websocket.CloseNormalClosure
+	if errors.Is(err, errSubscriptionClosed) {
+		closeCode = websocket.CloseTryAgainLater
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, ""), time.Now().Add(eventWriteTimeout))
+	return nil
+}
+
+// forward sends the events of the subscription following after, first those up to last from the collection and then
+// the delivered ones, until ctx is done, sending fails or the subscription is closed.
+func (f *EventFeed) forward(ctx context.Context, subscription *eventSubscription, after uint64, last uint64, send func(event *registry.Event) error, keepAlive func() error) error {
+	for replayed := after; after > 0 && replayed < last; {
+		events, err := f.events.LoadEvents(ctx, subscription.network, replayed, eventBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "service failed to load events")
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			if event.ID > last {
+				break
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+		replayed = events[len(events)-1].ID
+	}
+
+	keepAliveTicker := time.NewTicker(eventKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-subscription.events:
+			if !ok {
+				return errSubscriptionClosed
+			}
+			// the client may resume after an event this instance has not delivered yet
+			if event.ID <= after {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-keepAliveTicker.C:
+			if err := keepAlive(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// originChecker accepts WebSocket connections from the given origins and from clients that send no origin, which
+// are not browsers.
+func originChecker(allowOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(echo.HeaderOrigin)
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowOrigins {
+			if allowed == "*" || allowed == origin {
+				return true
+			}
+		}
+		return false
+	}
+}
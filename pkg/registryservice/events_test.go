@@ -0,0 +1,48 @@
+package registryservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// stubEvents records the events saved and the error of the context they were saved with.
+type stubEvents struct {
+	registry.EventService
+	saved   []*registry.Event
+	ctxErrs []error
+}
+
+func (s *stubEvents) SaveEvent(ctx context.Context, event *registry.Event) error {
+	s.saved = append(s.saved, event)
+	s.ctxErrs = append(s.ctxErrs, ctx.Err())
+	return nil
+}
+
+type testContextKey struct{}
+
+func TestPublishAfterCancel(t *testing.T) {
+	events := &stubEvents{}
+	feed := NewEventFeed(events, time.Second, time.Hour, nil)
+	var listenerValue interface{}
+	feed.OnPublish(func(ctx context.Context, event *registry.Event) {
+		listenerValue = ctx.Value(testContextKey{})
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "request"))
+	cancel()
+	feed.Publish(ctx, registryhttp.EventTokenRegistered, "alphanet", &registry.IRC30Token{ID: "0x01"})
+
+	if len(events.saved) != 1 {
+		t.Fatalf("%d events saved, want 1", len(events.saved))
+	}
+	if events.ctxErrs[0] != nil {
+		t.Errorf("event saved with a context that failed with %v", events.ctxErrs[0])
+	}
+	if listenerValue != "request" {
+		t.Errorf("listener context lost the request values, got %v", listenerValue)
+	}
+}
@@ -1,9 +1,14 @@
 package registryservice
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/capossele/swearfilter"
 	"github.com/cockroachdb/errors"
@@ -13,27 +18,23 @@ import (
 	"go.uber.org/zap"
 )
 
-var (
-	Networks = map[string]bool{
-		"alphanet": true,
-		"betanet":  false,
-		"shimmer":  false,
-	}
-)
-
 type HTTPHandler struct {
-	service  registry.Service
-	logger   *zap.SugaredLogger
-	verifier *Verifier
-	filter   *swearfilter.SwearFilter
-}
-
-func NewHTTPHandler(service registry.Service, logger *zap.SugaredLogger, verifier *Verifier) *HTTPHandler {
-	return &HTTPHandler{service: service, logger: logger, filter: swearfilter.NewSwearFilter(true, badWords...), verifier: verifier}
+	service    registry.Service
+	logger     *zap.SugaredLogger
+	verifier   *Verifier
+	filter     *swearfilter.SwearFilter
+	thumbnails *thumbnailCache
+	// logoFetcher pins the logos at LogoURL on registration, nil if disabled.
+	logoFetcher *LogoFetcher
+	auditor     *Auditor
+	events      *EventFeed
+	reports     registry.ReportService
+	// publicURL is the URL the registry is reached at, registry logos are linked relative to it.
+	publicURL string
 }
 
-func networkAllowed(network string) bool {
-	return Networks[network]
+func NewHTTPHandler(service registry.Service, logger *zap.SugaredLogger, verifier *Verifier, logoFetcher *LogoFetcher, auditor *Auditor, events *EventFeed, reports registry.ReportService, publicURL string) *HTTPHandler {
+	return &HTTPHandler{service: service, logger: logger, filter: NewSwearFilter(), verifier: verifier, thumbnails: newThumbnailCache(), logoFetcher: logoFetcher, auditor: auditor, events: events, reports: reports, publicURL: strings.TrimSuffix(publicURL, "/")}
 }
 
 // SaveToken saves a token to the registry
@@ -42,110 +43,239 @@ func networkAllowed(network string) bool {
 // 2. Perform token symbol length check
 // 3. Perform token name swear check
 // 4. Perform token symbol swear check
-// 5. Check if tokenId is legit
+// 5. Perform logo check and sanitize the logo
+// 6. Check if tokenId is legit
+// 7. Pin the logo at logoURL, if enabled
 func (h *HTTPHandler) SaveToken(c echo.Context) error {
 	ctx := c.Request().Context()
 	network := c.Param("network")
 	if !networkAllowed(network) {
-		return c.JSON(http.StatusForbidden, "network not allowed")
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
 	}
-	var token *registry.IRC30Token
-	if err := json.NewDecoder(c.Request().Body).Decode(&token); err != nil {
-		err = errors.Wrap(err, "failed to parse request body as JSON into an token")
-		h.logger.Infow("Invalid http request", "error", err)
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(err))
+	token, err := parseToken(c)
+	if err != nil {
+		observeRegistration(network, OutcomeRejected, ReasonInvalidRequest)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
 	}
 
-	// length checks
-	if len(token.Name) > 20 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("IRC30Token name too long"))
+	if kind, err := firstFailure(ctx, StaticChecks(h.filter, token)); err != nil {
+		observeRegistration(network, OutcomeRejected, kind)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
 	}
-
-	if len(token.Symbol) > 4 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("IRC30Token symbol too long"))
+	// only the sanitized logo is stored
+	logo, err := NormalizeLogo(token.Logo)
+	if err != nil {
+		observeRegistration(network, OutcomeRejected, ReasonLogo)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
 	}
+	token.Logo = logo
 
-	// filter
-	match, _ := h.filter.Check(token.Name)
-	if len(match) > 0 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s is forbidden, as contains %v", token.Name, match))
-	}
-	match, _ = h.filter.Check(token.ID)
-	if len(match) > 0 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s is forbidden, as contains %v", token.ID, match))
+	// semantic checks
+	// has a unique name, symbol and tokenId in the registry
+	if kind, err := firstFailure(ctx, UniquenessChecks(h.service, network, token)); err != nil {
+		observeRegistration(network, OutcomeRejected, kind)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
 	}
-	match, _ = h.filter.Check(token.Symbol)
-	if len(match) > 0 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s is forbidden, as contains %v", token.Symbol, match))
+	// token actually exists in the tangle, maxSupply matches the one in the foundry
+	foundry, err := h.verifier.Verify(ctx, network, token)
+	if err != nil {
+		observeRegistration(network, OutcomeRejected, ReasonVerification)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "token verification failed")))
 	}
 
-	match, _ = h.filter.Check(token.Description)
-	if len(match) > 0 {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s is forbidden, as contains %v", token.Description, match))
+	if h.logoFetcher != nil && token.LogoURL != "" {
+		pinned, err := h.logoFetcher.Fetch(ctx, token.LogoURL)
+		if err != nil {
+			observeRegistration(network, OutcomeRejected, ReasonLogo)
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "failed to pin logo from logoURL")))
+		}
+		if err := h.service.SaveLogo(ctx, pinned); err != nil {
+			observeRegistration(network, OutcomeError, ReasonStorage)
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save logo")))
+		}
+		token.LogoHash = pinned.Hash
 	}
 
-	// semantic checks
-	// has a unique name in the registry
-	if _, err := h.service.FindTokenByName(ctx, network, token.Name); err == nil {
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(errors.New("token name already taken")))
+	now := time.Now().UTC()
+	token.CreatedAt, token.UpdatedAt, token.VerifiedAt = now, now, now
+	token.Provenance = &registry.Provenance{
+		RegisteredBy:    registrant(c),
+		Node:            h.verifier.Node(),
+		MilestoneIndex:  foundry.LedgerIndex,
+		FoundryOutputID: foundry.OutputID.ToHex(),
 	}
-	// has a unique symbol in the registry
-	if _, err := h.service.FindTokenBySymbol(ctx, network, token.Symbol); err == nil {
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(errors.New("token symbol already taken")))
+	if err := h.service.SaveToken(ctx, network, token); err != nil {
+		observeRegistration(network, OutcomeError, ReasonStorage)
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "service failed to save Token")))
 	}
-	// has a unique tokenId in the registry
-	if _, err := h.service.LoadToken(ctx, network, token.ID); err == nil {
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(errors.New("token ID already registered")))
+
+	observeRegistration(network, OutcomeAccepted, "")
+	h.events.Publish(ctx, registryhttp.EventTokenRegistered, network, token)
+	return h.respondToken(c, http.StatusCreated, network, token, false)
+}
+
+// ValidateToken runs every check of SaveToken without saving the token and reports the outcome of each check.
+func (h *HTTPHandler) ValidateToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
 	}
-	// token actually exists in the tangle, maxSupply matches the one in the foundry
-	if err := h.verifier.Verify(token); err != nil {
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(errors.Wrap(err, "token verification failed")))
+	token, err := parseToken(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	// the remaining checks see the sanitized logo, as they would on registration
+	if logo, err := NormalizeLogo(token.Logo); err == nil {
+		token.Logo = logo
 	}
 
-	if err := h.service.SaveToken(ctx, network, token); err != nil {
-		return c.JSON(http.StatusBadRequest, registryhttp.NewErrorResponse(errors.Wrap(err, "service failed to save Token")))
+	checks := StaticChecks(h.filter, token)
+	checks = append(checks, UniquenessChecks(h.service, network, token)...)
+	checks = append(checks, VerificationCheck(h.verifier, network, token))
+	if h.logoFetcher != nil && token.LogoURL != "" {
+		checks = append(checks, LogoFetchCheck(h.logoFetcher, token))
 	}
+	results, valid := RunChecks(ctx, checks)
 
-	return c.JSON(http.StatusCreated, token)
+	return c.JSON(http.StatusOK, &registryhttp.ValidationResponse{Valid: valid, Checks: results})
 }
 
 func (h *HTTPHandler) LoadToken(c echo.Context) error {
 	ctx := c.Request().Context()
 	network := c.Param("network")
 	if !networkAllowed(network) {
-		return c.JSON(http.StatusForbidden, "network not allowed")
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
 	}
 	ID := c.Param("ID")
 	result, err := h.service.LoadToken(ctx, network, ID)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, errors.Wrap(err, "service failed to load IRC30Token"))
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load IRC30Token")))
 	}
-	return c.JSON(http.StatusOK, result)
+	return h.respondToken(c, http.StatusOK, network, result, true)
+}
+
+// LoadLogo serves the decoded logo of a token with caching headers. Raster logos are scaled down to a PNG
+// thumbnail if the size query parameter is one of the thumbnailSizes, SVG logos are always served as is.
+func (h *HTTPHandler) LoadLogo(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	ID := c.Param("ID")
+	token, err := h.service.LoadToken(ctx, network, ID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load IRC30Token")))
+	}
+	var logo []byte
+	switch {
+	case token.Logo != "":
+		if logo, err = DecodeLogo(token.Logo); err != nil {
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+		}
+	case token.LogoHash != "":
+		pinned, err := h.service.LoadLogo(ctx, token.LogoHash)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load pinned logo")))
+		}
+		logo = pinned.Data
+	default:
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.New("token has no logo")))
+	}
+
+	contentType := LogoType(logo)
+	hash := sha256.Sum256(logo)
+	etag := hex.EncodeToString(hash[:])
+
+	if sizeParam := c.QueryParam("size"); sizeParam != "" && contentType != LogoTypeSVG {
+		size, err := strconv.Atoi(sizeParam)
+		if err != nil || !thumbnailSizes[size] {
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid thumbnail size %q", sizeParam)))
+		}
+		etag = fmt.Sprintf("%s-%d", etag, size)
+		if logo, err = h.thumbnails.thumbnail(etag, logo, size); err != nil {
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "failed to render logo thumbnail")))
+		}
+		contentType = LogoTypePNG
+	}
+	return serveLogo(c, logo, contentType, etag, "public, max-age=86400")
+}
+
+// LoadPinnedLogo serves a pinned logo by its hash. The content of a hash never changes, so it is cached forever.
+func (h *HTTPHandler) LoadPinnedLogo(c echo.Context) error {
+	ctx := c.Request().Context()
+	hash := c.Param("hash")
+	logo, err := h.service.LoadLogo(ctx, hash)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load pinned logo")))
+	}
+	return serveLogo(c, logo.Data, logo.ContentType, logo.Hash, "public, max-age=31536000, immutable")
+}
+
+func serveLogo(c echo.Context, logo []byte, contentType string, etag string, cacheControl string) error {
+	etag = `"` + etag + `"`
+
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if contentType == LogoTypeSVG {
+		// the SVG is sanitized already, this keeps browsers from running anything it may still contain
+		header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	if match := c.Request().Header.Get("If-None-Match"); match == "*" || strings.Contains(match, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, contentType, logo)
 }
 
 func (h *HTTPHandler) LoadTokens(c echo.Context) error {
 	ctx := c.Request().Context()
 	network := c.Param("network")
 	if !networkAllowed(network) {
-		return c.JSON(http.StatusForbidden, "network not allowed")
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	minTrust := c.QueryParam("minTrust")
+	if minTrust != "" && registryhttp.TrustRank(minTrust) < 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid trust level %q, must be one of %s", minTrust, strings.Join(registryhttp.TrustLevels, ", "))))
 	}
 	result, err := h.service.LoadTokens(ctx, network)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, errors.Wrap(err, "service failed to load Assets"))
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load Assets")))
 	}
-	return c.JSON(http.StatusOK, result)
+	issuers, err := h.verifiedIssuers(ctx, network)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+	}
+	if minTrust != "" {
+		trusted := make([]*registry.IRC30Token, 0, len(result))
+		for _, token := range result {
+			if registryhttp.TrustRank(trustLevel(token, tokenIssuer(token, issuers))) >= registryhttp.TrustRank(minTrust) {
+				trusted = append(trusted, token)
+			}
+		}
+		result = trusted
+	}
+	return h.respondTokens(c, http.StatusOK, network, result, issuers)
 }
 
 func (h *HTTPHandler) DeleteTokensByID(c echo.Context) error {
 	ctx := c.Request().Context()
 	network := c.Param("network")
 	if !networkAllowed(network) {
-		return c.JSON(http.StatusForbidden, "network not allowed")
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
 	}
 	ID := c.Param("ID")
+	// the token is loaded first to tell the event subscribers what was deleted
+	token, loadErr := h.service.LoadToken(ctx, network, ID)
 	err := h.service.DeleteTokenByID(ctx, network, ID)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, errors.Wrap(err, "service failed to delete the IRC30Token"))
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to delete the IRC30Token")))
+	}
+	h.auditor.Record(c, "deleteTokenByID", network, ID)
+	if loadErr == nil {
+		h.events.Publish(ctx, registryhttp.EventTokenDeleted, network, token)
 	}
 	return c.JSON(http.StatusOK, nil)
 }
@@ -154,12 +284,17 @@ func (h *HTTPHandler) DeleteTokensByName(c echo.Context) error {
 	ctx := c.Request().Context()
 	network := c.Param("network")
 	if !networkAllowed(network) {
-		return c.JSON(http.StatusForbidden, "network not allowed")
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
 	}
 	name := c.Param("name")
+	token, loadErr := h.service.FindTokenByName(ctx, network, name)
 	err := h.service.DeleteTokenByName(ctx, network, name)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, errors.Wrap(err, "service failed to delete the IRC30Token"))
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to delete the IRC30Token")))
+	}
+	h.auditor.Record(c, "deleteTokenByName", network, name)
+	if loadErr == nil {
+		h.events.Publish(ctx, registryhttp.EventTokenDeleted, network, token)
 	}
 	return c.JSON(http.StatusOK, nil)
 }
@@ -172,17 +307,82 @@ func (h *HTTPHandler) LoadFilter(c echo.Context) error {
 func (h *HTTPHandler) AddFilter(c echo.Context) error {
 	word := c.Param("word")
 	if len(word) == 0 {
-		return c.JSON(http.StatusBadRequest, "invalid empty-string as filter")
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("invalid empty-string as filter")))
 	}
 	h.filter.Add(word)
+	h.auditor.Record(c, "addFilter", "", word)
 	return c.JSON(http.StatusOK, word)
 }
 
 func (h *HTTPHandler) DeleteFilter(c echo.Context) error {
 	word := c.Param("word")
 	if len(word) == 0 {
-		return c.JSON(http.StatusBadRequest, "invalid empty-string as filter")
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("invalid empty-string as filter")))
 	}
 	h.filter.Delete(word)
+	h.auditor.Record(c, "deleteFilter", "", word)
 	return c.JSON(http.StatusOK, word)
 }
+
+func (h *HTTPHandler) LoadNetworks(c echo.Context) error {
+	return c.JSON(http.StatusOK, LoadNetworks())
+}
+
+func (h *HTTPHandler) EnableNetwork(c echo.Context) error {
+	return h.setNetwork(c, true, "enableNetwork")
+}
+
+func (h *HTTPHandler) DisableNetwork(c echo.Context) error {
+	return h.setNetwork(c, false, "disableNetwork")
+}
+
+// setNetwork stores the network setting, so it survives restarts and reaches the other instances, and applies it.
+func (h *HTTPHandler) setNetwork(c echo.Context, enabled bool, action string) error {
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	setting := &registry.NetworkSetting{Network: network, Enabled: enabled, UpdatedAt: time.Now().UTC()}
+	if err := h.service.SaveNetworkSetting(c.Request().Context(), setting); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save network setting")))
+	}
+	SetNetwork(network, enabled)
+	h.auditor.Record(c, action, network, "")
+	return c.JSON(http.StatusOK, network)
+}
+
+// parseToken decodes the token of a registration or validation request and resets the fields only the registry may
+// set.
+func parseToken(c echo.Context) (*registry.IRC30Token, error) {
+	var token *registry.IRC30Token
+	if err := json.NewDecoder(c.Request().Body).Decode(&token); err != nil || token == nil {
+		if err == nil {
+			err = errors.New("token is missing")
+		}
+		err = errors.Wrap(err, "failed to parse request body as JSON into an token")
+		Logger(c).Infow("Invalid http request", "error", err)
+		return nil, err
+	}
+	clearRegistryFields(token)
+	return token, nil
+}
+
+// clearRegistryFields resets the fields only the registry may set, should a client send them.
+func clearRegistryFields(token *registry.IRC30Token) {
+	token.LogoHash = ""
+	token.CreatedAt = time.Time{}
+	token.UpdatedAt = time.Time{}
+	token.VerifiedAt = time.Time{}
+	token.Provenance = nil
+	token.VerificationStatus = ""
+	token.Flag = nil
+	token.TrustLevel = ""
+}
+
+// registrant identifies who registers a token, the admin if authenticated or the IP of the client otherwise.
+func registrant(c echo.Context) string {
+	if identity := AdminIdentity(c); identity != nil {
+		return identity.String()
+	}
+	return ClientIP(c)
+}
@@ -0,0 +1,69 @@
+package registryservice
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	leasesCollection = "_leases"
+
+	// workerLeaseMargin defines how long a worker lease outlasts the interval of its worker, so the holder renews it
+	// before another instance can claim it.
+	workerLeaseMargin = time.Minute
+)
+
+// instanceID identifies this instance as the holder of worker leases.
+var instanceID = newInstanceID()
+
+// ClaimLease claims the lease name for holder until now plus ttl, if it is free, expired or held by holder already.
+// It returns false if another holder holds the lease.
+func (s *Service) ClaimLease(ctx context.Context, name string, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	_, err := s.db.Collection(leasesCollection).UpdateOne(ctx,
+		bson.M{"_id": name, "$or": bson.A{bson.M{"holder": holder}, bson.M{"expiresAt": bson.M{"$lte": now}}}},
+		bson.M{"$set": bson.M{"holder": holder, "expiresAt": now.Add(ttl)}},
+		options.Update().SetUpsert(true))
+	// the upsert inserts a second lease with the same name if the lease is held by another holder
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim lease in mongo collection")
+	}
+	return true, nil
+}
+
+// WorkerLease lets a worker run on a single instance at a time. The instance that claimed the lease keeps it as long as
+// it claims it again every interval, another instance takes over once it expired.
+type WorkerLease struct {
+	leases registry.LeaseService
+	name   string
+	ttl    time.Duration
+}
+
+// NewWorkerLease creates the lease of the worker name, which runs every interval.
+func NewWorkerLease(leases registry.LeaseService, name string, interval time.Duration) *WorkerLease {
+	return &WorkerLease{leases: leases, name: name, ttl: interval + workerLeaseMargin}
+}
+
+// Claim tells whether this instance holds the lease, claiming or renewing it. A failure to claim it is logged.
+func (l *WorkerLease) Claim(ctx context.Context) bool {
+	claimed, err := l.leases.ClaimLease(ctx, l.name, instanceID, time.Now().UTC(), l.ttl)
+	if err != nil {
+		ContextLogger(ctx).Warnw("Failed to claim worker lease", "worker", l.name, "error", err)
+	}
+	return claimed
+}
+
+func newInstanceID() string {
+	hostname, _ := os.Hostname()
+	ID, _ := randomString(8)
+	return hostname + "-" + ID
+}
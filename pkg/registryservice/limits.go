@@ -0,0 +1,185 @@
+package registryservice
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"golang.org/x/time/rate"
+)
+
+const (
+	LimitIP            = "ip"
+	LimitGlobal        = "global"
+	LimitBodySize      = "bodySize"
+	LimitVerifications = "verifications"
+	LimitEventStreams  = "eventStreams"
+	LimitSupplyReads   = "supplyReads"
+
+	// clientLimiterTTL defines how long the limiter of an idle client is kept at least, and how often idle limiters are
+	// pruned.
+	clientLimiterTTL = 10 * time.Minute
+	// busyRetryAfter defines the Retry-After of requests rejected because too many are in flight.
+	busyRetryAfter = 1 * time.Second
+)
+
+// RateLimiter limits the request rate per client IP and across all clients. A limit with a rate of zero is disabled.
+type RateLimiter struct {
+	global *rate.Limiter
+
+	perIP      rate.Limit
+	perIPBurst int
+	// clientTTL defines how long the limiter of an idle client is kept, at least until its burst refilled, as a new
+	// limiter would grant the full burst again.
+	clientTTL time.Duration
+	// trustProxyHeaders defines whether the client IP is taken from X-Forwarded-For and X-Real-IP.
+	trustProxyHeaders bool
+
+	clientsMutex sync.Mutex
+	clients      map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing perIP requests per second to each client and global requests per
+// second in total, each with the given burst.
+func NewRateLimiter(perIP float64, perIPBurst int, global float64, globalBurst int, trustProxyHeaders bool) *RateLimiter {
+	r := &RateLimiter{
+		perIP:             rate.Limit(perIP),
+		perIPBurst:        perIPBurst,
+		clientTTL:         clientLimiterTTL,
+		trustProxyHeaders: trustProxyHeaders,
+		clients:           make(map[string]*clientLimiter),
+	}
+	if perIP > 0 {
+		if refill := time.Duration(float64(perIPBurst) / perIP * float64(time.Second)); refill > r.clientTTL {
+			r.clientTTL = refill
+		}
+	}
+	if global > 0 {
+		r.global = rate.NewLimiter(rate.Limit(global), globalBurst)
+	}
+	return r
+}
+
+// Middleware rejects requests exceeding the rate limits with 429 and a Retry-After header.
+func (r *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			now := time.Now()
+			var reservations []*rate.Reservation
+			cancel := func() {
+				for _, reservation := range reservations {
+					reservation.CancelAt(now)
+				}
+			}
+
+			if limiter := r.clientLimiter(clientIP(c, r.trustProxyHeaders), now); limiter != nil {
+				reservation := limiter.ReserveN(now, 1)
+				reservations = append(reservations, reservation)
+				if delay := reservation.DelayFrom(now); delay > 0 {
+					cancel()
+					return rejectRequest(c, LimitIP, http.StatusTooManyRequests, delay)
+				}
+			}
+			if r.global != nil {
+				reservation := r.global.ReserveN(now, 1)
+				reservations = append(reservations, reservation)
+				if delay := reservation.DelayFrom(now); delay > 0 {
+					cancel()
+					return rejectRequest(c, LimitGlobal, http.StatusTooManyRequests, delay)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// Run prunes the limiters of idle clients until ctx is done.
+func (r *RateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(clientLimiterTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.prune(now)
+		}
+	}
+}
+
+// prune removes the limiters of clients idle for longer than the client TTL.
+func (r *RateLimiter) prune(now time.Time) {
+	r.clientsMutex.Lock()
+	defer r.clientsMutex.Unlock()
+	for ip, client := range r.clients {
+		if now.Sub(client.lastSeen) > r.clientTTL {
+			delete(r.clients, ip)
+		}
+	}
+}
+
+func (r *RateLimiter) clientLimiter(ip string, now time.Time) *rate.Limiter {
+	if r.perIP <= 0 {
+		return nil
+	}
+	r.clientsMutex.Lock()
+	defer r.clientsMutex.Unlock()
+	client, ok := r.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(r.perIP, r.perIPBurst)}
+		r.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// BodyLimit rejects request bodies larger than limit bytes with 413.
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return rejectRequest(c, LimitBodySize, http.StatusRequestEntityTooLarge, 0)
+			}
+			// bodies without or with a wrong content length fail to decode once they exceed the limit
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+			return next(c)
+		}
+	}
+}
+
+// ConcurrencyLimit rejects requests with 429 while max requests are in flight, reporting them as exceeding limit. It
+// caps the concurrent verifications, which each query MongoDB and the node, the API v2 token reads and the open event
+// streams.
+func ConcurrencyLimit(limit string, max int) echo.MiddlewareFunc {
+	inFlight := make(chan struct{}, max)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+				return next(c)
+			default:
+				return rejectRequest(c, limit, http.StatusTooManyRequests, busyRetryAfter)
+			}
+		}
+	}
+}
+
+func rejectRequest(c echo.Context, limit string, status int, retryAfter time.Duration) error {
+	observeLimitRejection(limit, c.Path())
+	if retryAfter > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return c.JSON(status, errorResponse(c, errors.Newf("request exceeds the %s limit", limit)))
+}
@@ -0,0 +1,193 @@
+package registryservice
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+func TestRateLimiter(t *testing.T) {
+	type request struct {
+		remoteAddr     string
+		forwardedFor   string
+		wantStatus     int
+		wantRetryAfter string
+	}
+	tests := []struct {
+		name              string
+		perIP             float64
+		perIPBurst        int
+		global            float64
+		globalBurst       int
+		trustProxyHeaders bool
+		requests          []request
+	}{
+		{
+			name:  "per IP",
+			perIP: 1, perIPBurst: 2,
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK},
+				{remoteAddr: "192.0.2.1:1235", wantStatus: http.StatusOK},
+				{remoteAddr: "192.0.2.1:1236", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1"},
+				{remoteAddr: "192.0.2.2:1234", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name:   "global",
+			global: 0.1, globalBurst: 1,
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK},
+				{remoteAddr: "192.0.2.2:1234", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "10"},
+			},
+		},
+		{
+			name:  "rejected requests do not use up the global limit",
+			perIP: 0.1, perIPBurst: 1, global: 0.1, globalBurst: 2,
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK},
+				{remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "10"},
+				{remoteAddr: "192.0.2.2:1234", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name:  "proxy headers ignored",
+			perIP: 0.1, perIPBurst: 1,
+			requests: []request{
+				{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.1", wantStatus: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.2", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "10"},
+			},
+		},
+		{
+			name:  "proxy headers trusted",
+			perIP: 0.1, perIPBurst: 1, trustProxyHeaders: true,
+			requests: []request{
+				{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.1", wantStatus: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.2", wantStatus: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.1", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "10"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.perIP, test.perIPBurst, test.global, test.globalBurst, test.trustProxyHeaders)
+			handler := limiter.Middleware()(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+			for i, r := range test.requests {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = r.remoteAddr
+				if r.forwardedFor != "" {
+					req.Header.Set(echo.HeaderXForwardedFor, r.forwardedFor)
+				}
+				rec := httptest.NewRecorder()
+				if err := handler(echo.New().NewContext(req, rec)); err != nil {
+					t.Fatal(err)
+				}
+				if rec.Code != r.wantStatus {
+					t.Errorf("request %d returned %d, want %d", i, rec.Code, r.wantStatus)
+				}
+				if got := rec.Header().Get("Retry-After"); got != r.wantRetryAfter {
+					t.Errorf("request %d has Retry-After %q, want %q", i, got, r.wantRetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := ConcurrencyLimit(LimitVerifications, 1)(func(c echo.Context) error {
+		started <- struct{}{}
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)); err != nil {
+			t.Error(err)
+		}
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- request() }()
+	<-started
+	busy := request()
+	if busy.Code != http.StatusTooManyRequests || busy.Header().Get("Retry-After") != "1" {
+		t.Errorf("request while busy returned %d with Retry-After %q, want %d with 1", busy.Code, busy.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	close(release)
+	if first := <-done; first.Code != http.StatusOK {
+		t.Errorf("first request returned %d, want %d", first.Code, http.StatusOK)
+	}
+	go func() { <-started }()
+	if again := request(); again.Code != http.StatusOK {
+		t.Errorf("request after the first finished returned %d, want %d", again.Code, http.StatusOK)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantStatus    int
+	}{
+		{name: "within limit", body: strings.Repeat("a", 16), contentLength: 16, wantStatus: http.StatusOK},
+		{name: "declared too large", body: strings.Repeat("a", 17), contentLength: 17, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "unknown length too large", body: strings.Repeat("a", 17), contentLength: -1, wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := BodyLimit(16)(func(c echo.Context) error {
+				if _, err := io.ReadAll(c.Request().Body); err != nil {
+					return c.NoContent(http.StatusBadRequest)
+				}
+				return c.NoContent(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			req.ContentLength = test.contentLength
+			rec := httptest.NewRecorder()
+			if err := handler(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRateLimiterKeepsClientsUntilRefilled(t *testing.T) {
+	// the report limiter allows 5 requests per hour
+	limiter := NewRateLimiter(5.0/3600, 5, 0, 0, false)
+	handler := limiter.Middleware()(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	request := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		if err := handler(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	for i := 0; i < 5; i++ {
+		if code := request(); code != http.StatusOK {
+			t.Fatalf("request %d returned %d, want %d", i, code, http.StatusOK)
+		}
+	}
+
+	limiter.prune(time.Now().Add(2 * clientLimiterTTL))
+	if code := request(); code != http.StatusTooManyRequests {
+		t.Errorf("request after pruning idle clients returned %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	limiter.prune(time.Now().Add(time.Hour + time.Minute))
+	if len(limiter.clients) != 0 {
+		t.Errorf("%d clients kept after their burst refilled, want none", len(limiter.clients))
+	}
+}
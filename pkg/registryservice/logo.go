@@ -0,0 +1,411 @@
+package registryservice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"image"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// maxLogoSize defines the maximum size of a decoded logo in bytes.
+	maxLogoSize = 100 * 1024
+	// maxLogoDimension defines the maximum width and height of a logo in pixels.
+	maxLogoDimension = 1024
+
+	// maxCachedThumbnails defines how many rendered thumbnails are kept in memory.
+	maxCachedThumbnails = 1024
+
+	LogoTypeSVG  = "image/svg+xml"
+	LogoTypePNG  = "image/png"
+	LogoTypeWebP = "image/webp"
+)
+
+var (
+	pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+	// thumbnailSizes are the sizes in pixels raster logos can be scaled down to.
+	thumbnailSizes = map[int]bool{16: true, 32: true, 64: true, 128: true, 256: true}
+
+	// svgForbiddenElements are dropped from SVG logos together with their content.
+	svgForbiddenElements = map[string]bool{
+		"script":        true,
+		"foreignobject": true,
+		"iframe":        true,
+		"embed":         true,
+		"object":        true,
+		"audio":         true,
+		"video":         true,
+		"handler":       true,
+		"listener":      true,
+		"set":           true,
+		"animate":       true,
+	}
+
+	cssURLPattern  = regexp.MustCompile(`(?i)url\(\s*['"]?\s*([^'")\s]*)`)
+	svgSizePattern = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*(px)?\s*$`)
+)
+
+// DecodeLogo decodes a hex encoded logo, with or without 0x prefix.
+func DecodeLogo(hexLogo string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(hexLogo, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "logo is not a valid hex string")
+	}
+	return data, nil
+}
+
+// EncodeLogo hex encodes a logo with 0x prefix.
+func EncodeLogo(logo []byte) string {
+	return "0x" + hex.EncodeToString(logo)
+}
+
+// LogoType returns the content type of a decoded logo, or an empty string if it is none of SVG, PNG or WebP.
+func LogoType(logo []byte) string {
+	switch {
+	case bytes.HasPrefix(logo, pngMagic):
+		return LogoTypePNG
+	case len(logo) >= 12 && string(logo[:4]) == "RIFF" && string(logo[8:12]) == "WEBP":
+		return LogoTypeWebP
+	case isSVG(logo):
+		return LogoTypeSVG
+	default:
+		return ""
+	}
+}
+
+// pinnedLogo returns the content-addressed logo of the normalized logo.
+func pinnedLogo(logo []byte) *registry.Logo {
+	hash := sha256.Sum256(logo)
+	return &registry.Logo{Hash: hex.EncodeToString(hash[:]), ContentType: LogoType(logo), Data: logo}
+}
+
+// NormalizeLogo validates a hex encoded logo against the size and dimension limits and returns its safe,
+// normalized form: SVGs are sanitized, PNGs are re-encoded without ancillary chunks and WebPs are kept as is.
+func NormalizeLogo(hexLogo string) (string, error) {
+	if hexLogo == "" {
+		return "", nil
+	}
+	logo, err := DecodeLogo(hexLogo)
+	if err != nil {
+		return "", err
+	}
+	normalized, err := normalizeLogo(logo)
+	if err != nil {
+		return "", err
+	}
+	return EncodeLogo(normalized), nil
+}
+
+func normalizeLogo(logo []byte) ([]byte, error) {
+	if len(logo) > maxLogoSize {
+		return nil, errors.Newf("logo exceeds the maximum size of %d bytes", maxLogoSize)
+	}
+
+	switch LogoType(logo) {
+	case LogoTypePNG:
+		// check the dimensions before decoding to not allocate the pixels of a decompression bomb
+		config, err := png.DecodeConfig(bytes.NewReader(logo))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode png logo")
+		}
+		if err := checkLogoDimensions(config.Width, config.Height); err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(bytes.NewReader(logo))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode png logo")
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, errors.Wrap(err, "failed to encode png logo")
+		}
+		return buf.Bytes(), nil
+
+	case LogoTypeWebP:
+		config, err := webp.DecodeConfig(bytes.NewReader(logo))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode webp logo")
+		}
+		if err := checkLogoDimensions(config.Width, config.Height); err != nil {
+			return nil, err
+		}
+		if _, err := webp.Decode(bytes.NewReader(logo)); err != nil {
+			return nil, errors.Wrap(err, "failed to decode webp logo")
+		}
+		return logo, nil
+
+	case LogoTypeSVG:
+		return sanitizeSVG(logo)
+
+	default:
+		return nil, errors.New("logo is neither svg, png nor webp")
+	}
+}
+
+// DecodeLogoImage decodes a raster logo into an image.
+func DecodeLogoImage(logo []byte) (image.Image, error) {
+	switch LogoType(logo) {
+	case LogoTypePNG:
+		return png.Decode(bytes.NewReader(logo))
+	case LogoTypeWebP:
+		return webp.Decode(bytes.NewReader(logo))
+	default:
+		return nil, errors.New("logo is not a raster image")
+	}
+}
+
+// LogoThumbnail renders a raster logo as PNG fitting into a size x size square, keeping the aspect ratio.
+// Logos smaller than the square are not scaled up.
+func LogoThumbnail(logo []byte, size int) ([]byte, error) {
+	src, err := DecodeLogoImage(logo)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, height*size/width
+		} else {
+			width, height = width*size/height, size
+		}
+	}
+	if width == 0 {
+		width = 1
+	}
+	if height == 0 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, errors.Wrap(err, "failed to encode logo thumbnail")
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnailCache keeps rendered thumbnails by logo hash and size.
+type thumbnailCache struct {
+	sync.Mutex
+	thumbnails map[string][]byte
+}
+
+func newThumbnailCache() *thumbnailCache {
+	return &thumbnailCache{thumbnails: make(map[string][]byte)}
+}
+
+// thumbnail returns the cached thumbnail for key or renders and caches it.
+func (t *thumbnailCache) thumbnail(key string, logo []byte, size int) ([]byte, error) {
+	t.Lock()
+	thumbnail, ok := t.thumbnails[key]
+	t.Unlock()
+	if ok {
+		return thumbnail, nil
+	}
+
+	thumbnail, err := LogoThumbnail(logo, size)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	if len(t.thumbnails) >= maxCachedThumbnails {
+		t.thumbnails = make(map[string][]byte)
+	}
+	t.thumbnails[key] = thumbnail
+	return thumbnail, nil
+}
+
+func checkLogoDimensions(width, height int) error {
+	if width > maxLogoDimension || height > maxLogoDimension {
+		return errors.Newf("logo dimensions %dx%d exceed the maximum of %dx%d", width, height, maxLogoDimension, maxLogoDimension)
+	}
+	return nil
+}
+
+func isSVG(logo []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(logo))
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return strings.EqualFold(start.Name.Local, "svg")
+		}
+	}
+}
+
+// sanitizeSVG rewrites an SVG without doctype, processing instructions, comments, scripts and other active
+// elements, event handler attributes and references to external resources.
+func sanitizeSVG(logo []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(logo))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	// skipDepth counts the open elements inside a dropped element
+	skipDepth := 0
+	// inStyle is set while inside a style element, whose content is checked as a whole
+	inStyle := false
+	var style bytes.Buffer
+	rootSeen := false
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse svg logo")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || svgForbiddenElements[strings.ToLower(t.Name.Local)] {
+				skipDepth++
+				continue
+			}
+			if !rootSeen {
+				rootSeen = true
+				if err := checkSVGDimensions(t); err != nil {
+					return nil, err
+				}
+			}
+			if strings.EqualFold(t.Name.Local, "style") {
+				inStyle = true
+				style.Reset()
+			}
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if !safeSVGAttr(attr) {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				xml.EscapeText(&out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			if inStyle && strings.EqualFold(t.Name.Local, "style") {
+				inStyle = false
+				if safeCSS(style.String()) {
+					xml.EscapeText(&out, style.Bytes())
+				}
+			}
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			if inStyle {
+				style.Write(t)
+				continue
+			}
+			xml.EscapeText(&out, t)
+		}
+	}
+
+	if !rootSeen {
+		return nil, errors.New("svg logo has no root element")
+	}
+	if out.Len() > maxLogoSize {
+		return nil, errors.Newf("logo exceeds the maximum size of %d bytes", maxLogoSize)
+	}
+	return out.Bytes(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// safeSVGAttr tells whether an attribute can neither execute code nor load an external resource.
+func safeSVGAttr(attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	value := strings.ToLower(strings.TrimSpace(attr.Value))
+	switch {
+	case strings.HasPrefix(local, "on"):
+		return false
+	case local == "href" || local == "src":
+		return strings.HasPrefix(value, "#")
+	case strings.Contains(value, "javascript:"):
+		return false
+	default:
+		return safeCSS(value)
+	}
+}
+
+// safeCSS tells whether a style only references resources inside the document.
+func safeCSS(css string) bool {
+	if strings.Contains(strings.ToLower(css), "@import") {
+		return false
+	}
+	for _, match := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		if !strings.HasPrefix(match[1], "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSVGDimensions checks the width and height of the root element, falling back to its viewBox.
+func checkSVGDimensions(root xml.StartElement) error {
+	if !strings.EqualFold(root.Name.Local, "svg") {
+		return errors.New("svg logo root element is not svg")
+	}
+	var width, height float64
+	for _, attr := range root.Attr {
+		switch attr.Name.Local {
+		case "width":
+			width = parseSVGSize(attr.Value)
+		case "height":
+			height = parseSVGSize(attr.Value)
+		case "viewBox":
+			fields := strings.Fields(strings.ReplaceAll(attr.Value, ",", " "))
+			if len(fields) == 4 {
+				if width == 0 {
+					width, _ = strconv.ParseFloat(fields[2], 64)
+				}
+				if height == 0 {
+					height, _ = strconv.ParseFloat(fields[3], 64)
+				}
+			}
+		}
+	}
+	return checkLogoDimensions(int(width), int(height))
+}
+
+// parseSVGSize parses a length in pixels, returning 0 for relative or unknown units.
+func parseSVGSize(value string) float64 {
+	match := svgSizePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0
+	}
+	size, _ := strconv.ParseFloat(match[1], 64)
+	return size
+}
@@ -0,0 +1,164 @@
+package registryservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+)
+
+const (
+	// maxLogoRedirects defines how many redirects are followed when fetching a logo.
+	maxLogoRedirects = 3
+)
+
+// nonPublicNetworks are the address ranges logos are never fetched from and webhooks are not posted to by default.
+var nonPublicNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// LogoFetcher downloads logos from the LogoURL of tokens, refusing to connect to non-public addresses.
+type LogoFetcher struct {
+	client *http.Client
+}
+
+// NewLogoFetcher creates a new logo fetcher giving up on a download after timeout.
+func NewLogoFetcher(timeout time.Duration) *LogoFetcher {
+	dialer := publicDialer(timeout, "fetch logo from")
+	return &LogoFetcher{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				// a proxy would connect on our behalf and bypass the address check
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxLogoRedirects {
+					return errors.New("too many redirects")
+				}
+				return checkLogoURL(req.URL)
+			},
+		},
+	}
+}
+
+// Fetch downloads the logo at logoURL and returns its normalized, content-addressed form.
+func (f *LogoFetcher) Fetch(ctx context.Context, logoURL string) (*registry.Logo, error) {
+	parsed, err := url.Parse(logoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse logoURL")
+	}
+	if err := checkLogoURL(parsed); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create logo request")
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch logo")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("failed to fetch logo, status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read logo")
+	}
+	// the content type is sniffed by normalizeLogo, the one sent by the server is not trusted
+	normalized, err := normalizeLogo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(normalized)
+	return &registry.Logo{
+		Hash:        hex.EncodeToString(hash[:]),
+		ContentType: LogoType(normalized),
+		Data:        normalized,
+		SourceURL:   logoURL,
+		FetchedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// publicDialer creates a dialer refusing to connect to non-public addresses, action describes the refused connection
+// in the error.
+func publicDialer(timeout time.Duration, action string) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		// the address is checked after name resolution, so DNS can not point the dialer at internal hosts
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(net.ParseIP(host)) {
+				return errors.Newf("refusing to %s non-public address %s", action, host)
+			}
+			return nil
+		},
+	}
+}
+
+func checkLogoURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Newf("unsupported logoURL scheme %q", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("logoURL must not contain credentials")
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
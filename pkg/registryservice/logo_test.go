@@ -0,0 +1,232 @@
+package registryservice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		svg     string
+		removed []string
+		kept    []string
+	}{
+		{
+			name:    "script",
+			svg:     `<svg width="10" height="10"><script>alert(1)</script><circle r="5"/></svg>`,
+			removed: []string{"script", "alert"},
+			kept:    []string{"<circle"},
+		},
+		{
+			name:    "nested script in foreignObject",
+			svg:     `<svg width="10" height="10"><foreignObject><div><script>alert(1)</script></div></foreignObject></svg>`,
+			removed: []string{"foreignObject", "div", "alert"},
+		},
+		{
+			name:    "event handler",
+			svg:     `<svg width="10" height="10" onload="alert(1)"><rect onClick="alert(2)" width="1"/></svg>`,
+			removed: []string{"onload", "onClick", "alert"},
+			kept:    []string{`width="1"`},
+		},
+		{
+			name:    "external href",
+			svg:     `<svg xmlns:xlink="http://www.w3.org/1999/xlink" width="10" height="10"><image xlink:href="https://evil.example/x.png"/><use href="#a"/></svg>`,
+			removed: []string{"evil.example"},
+			kept:    []string{`href="#a"`},
+		},
+		{
+			name:    "javascript url",
+			svg:     `<svg width="10" height="10"><a target="javascript:alert(1)"/></svg>`,
+			removed: []string{"javascript"},
+		},
+		{
+			name:    "external style",
+			svg:     `<svg width="10" height="10"><style>@import url(https://evil.example/a.css);</style><rect style="fill:url(https://evil.example/t)"/><rect style="fill:url(#g)"/></svg>`,
+			removed: []string{"evil.example", "@import"},
+			kept:    []string{`style="fill:url(#g)"`},
+		},
+		{
+			name:    "doctype and comments",
+			svg:     `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY x "y">]><!-- hidden --><svg width="10" height="10"/>`,
+			removed: []string{"DOCTYPE", "ENTITY", "hidden", "<?xml"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sanitized, err := sanitizeSVG([]byte(test.svg))
+			if err != nil {
+				t.Fatalf("sanitizeSVG() error = %v", err)
+			}
+			for _, s := range test.removed {
+				if strings.Contains(string(sanitized), s) {
+					t.Errorf("sanitizeSVG() = %s, still contains %q", sanitized, s)
+				}
+			}
+			for _, s := range test.kept {
+				if !strings.Contains(string(sanitized), s) {
+					t.Errorf("sanitizeSVG() = %s, lost %q", sanitized, s)
+				}
+			}
+			again, err := sanitizeSVG(sanitized)
+			if err != nil || !bytes.Equal(again, sanitized) {
+				t.Errorf("sanitizeSVG() is not idempotent: %s became %s, %v", sanitized, again, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeLogo(t *testing.T) {
+	tests := []struct {
+		name     string
+		logo     []byte
+		wantType string
+		wantErr  bool
+	}{
+		{name: "svg", logo: []byte(`<svg width="64" height="64"/>`), wantType: LogoTypeSVG},
+		{name: "svg viewBox", logo: []byte(`<svg viewBox="0 0 64 64"/>`), wantType: LogoTypeSVG},
+		{name: "svg too wide", logo: []byte(`<svg width="4096" height="64"/>`), wantErr: true},
+		{name: "svg too large viewBox", logo: []byte(`<svg viewBox="0 0 64 4096"/>`), wantErr: true},
+		{name: "html", logo: []byte(`<html><script>alert(1)</script></html>`), wantErr: true},
+		{name: "png", logo: testPNG(t, 32, 32), wantType: LogoTypePNG},
+		{name: "png too large", logo: testPNG(t, 2048, 1), wantErr: true},
+		{name: "truncated png", logo: testPNG(t, 32, 32)[:40], wantErr: true},
+		{name: "oversized", logo: append([]byte("<svg>"), make([]byte, maxLogoSize)...), wantErr: true},
+		{name: "text", logo: []byte("not a logo"), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized, err := NormalizeLogo(EncodeLogo(test.logo))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("NormalizeLogo() = %s, want error", normalized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeLogo() error = %v", err)
+			}
+			logo, err := DecodeLogo(normalized)
+			if err != nil {
+				t.Fatalf("DecodeLogo() error = %v", err)
+			}
+			if got := LogoType(logo); got != test.wantType {
+				t.Errorf("LogoType() = %q, want %q", got, test.wantType)
+			}
+		})
+	}
+}
+
+func TestNormalizeLogoEmpty(t *testing.T) {
+	if normalized, err := NormalizeLogo(""); err != nil || normalized != "" {
+		t.Errorf("NormalizeLogo(\"\") = %q, %v, want no logo", normalized, err)
+	}
+	if _, err := NormalizeLogo("0xzz"); err == nil {
+		t.Error("NormalizeLogo() accepted invalid hex")
+	}
+}
+
+func TestLogoThumbnail(t *testing.T) {
+	thumbnail, err := LogoThumbnail(testPNG(t, 200, 100), 64)
+	if err != nil {
+		t.Fatalf("LogoThumbnail() error = %v", err)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail is no png: %v", err)
+	}
+	if config.Width != 64 || config.Height != 32 {
+		t.Errorf("thumbnail is %dx%d, want 64x32", config.Width, config.Height)
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadLogo(t *testing.T) {
+	raster := testPNG(t, 200, 100)
+	rasterHash := sha256.Sum256(raster)
+	rasterETag := hex.EncodeToString(rasterHash[:])
+	svg := []byte(`<svg width="64" height="64"/>`)
+	svgHash := sha256.Sum256(svg)
+	service := &stubTokens{tokens: []*registry.IRC30Token{
+		{ID: "0x01", Logo: EncodeLogo(raster)},
+		{ID: "0x02", Logo: EncodeLogo(svg)},
+		{ID: "0x03"},
+	}}
+	tests := []struct {
+		name        string
+		ID          string
+		size        string
+		ifNoneMatch string
+		wantStatus  int
+		wantType    string
+		wantETag    string
+		wantWidth   int
+	}{
+		{name: "png", ID: "0x01", wantStatus: http.StatusOK, wantType: LogoTypePNG, wantETag: rasterETag, wantWidth: 200},
+		{name: "thumbnail", ID: "0x01", size: "64", wantStatus: http.StatusOK, wantType: LogoTypePNG, wantETag: rasterETag + "-64", wantWidth: 64},
+		{name: "unsupported size", ID: "0x01", size: "100", wantStatus: http.StatusBadRequest},
+		{name: "invalid size", ID: "0x01", size: "large", wantStatus: http.StatusBadRequest},
+		{name: "svg ignores size", ID: "0x02", size: "64", wantStatus: http.StatusOK, wantType: LogoTypeSVG, wantETag: hex.EncodeToString(svgHash[:])},
+		{name: "not modified", ID: "0x01", ifNoneMatch: `"` + rasterETag + `"`, wantStatus: http.StatusNotModified, wantETag: rasterETag},
+		{name: "thumbnail not modified", ID: "0x01", size: "64", ifNoneMatch: `"` + rasterETag + `-64"`, wantStatus: http.StatusNotModified, wantETag: rasterETag + "-64"},
+		{name: "modified", ID: "0x01", ifNoneMatch: `"other"`, wantStatus: http.StatusOK, wantType: LogoTypePNG, wantETag: rasterETag, wantWidth: 200},
+		{name: "no logo", ID: "0x03", wantStatus: http.StatusNotFound},
+		{name: "unknown token", ID: "0x04", wantStatus: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &HTTPHandler{service: service, thumbnails: newThumbnailCache()}
+			req := httptest.NewRequest(http.MethodGet, "/?size="+test.size, nil)
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("network", "ID")
+			c.SetParamValues("alphanet", test.ID)
+			if err := h.LoadLogo(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			if test.wantETag != "" {
+				if got := rec.Header().Get("ETag"); got != `"`+test.wantETag+`"` {
+					t.Errorf("ETag = %s, want %q", got, test.wantETag)
+				}
+			}
+			if test.wantType != "" {
+				if got := rec.Header().Get(echo.HeaderContentType); got != test.wantType {
+					t.Errorf("Content-Type = %s, want %s", got, test.wantType)
+				}
+			}
+			if test.wantWidth != 0 {
+				config, err := png.DecodeConfig(rec.Body)
+				if err != nil {
+					t.Fatalf("logo is no png: %v", err)
+				}
+				if config.Width != test.wantWidth {
+					t.Errorf("logo is %d wide, want %d", config.Width, test.wantWidth)
+				}
+			}
+		})
+	}
+}
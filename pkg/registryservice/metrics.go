@@ -0,0 +1,160 @@
+package registryservice
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	metricsNamespace = "token_verifier"
+
+	// tokenCountTimeout defines how long counting the tokens of all networks may take during a scrape.
+	tokenCountTimeout = 5 * time.Second
+
+	OutcomeAccepted = "accepted"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+
+	// rejection reasons of registrations, checks report theirs through Check.Kind
+	ReasonInvalidRequest = "invalidRequest"
+	ReasonValidation     = "validation"
+	ReasonFilter         = "filter"
+	ReasonUniqueness     = "uniqueness"
+	ReasonVerification   = "verification"
+	ReasonLogo           = "logo"
+	ReasonStorage        = "storage"
+)
+
+var (
+	registrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "registrations_total",
+		Help:      "Token registration attempts by network, outcome and rejection reason.",
+	}, []string{"network", "outcome", "reason"})
+
+	nodeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_request_duration_seconds",
+		Help:      "Latency of the verifier calls to the node by network, operation and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"network", "operation", "outcome"})
+
+	mongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "mongo_operation_duration_seconds",
+		Help:      "Latency of MongoDB commands by command name and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command", "outcome"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	limitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "limit_rejections_total",
+		Help:      "Requests rejected by rate, body size and concurrency limits by limit and route.",
+	}, []string{"limit", "route"})
+
+	tokenCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "tokens"),
+		"Registered tokens by network.",
+		[]string{"network"}, nil,
+	)
+)
+
+func observeRegistration(network string, outcome string, reason string) {
+	registrations.WithLabelValues(network, outcome, reason).Inc()
+}
+
+func observeNodeRequest(network string, operation string, start time.Time, err error) {
+	nodeRequestDuration.WithLabelValues(network, operation, outcomeLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+func observeLimitRejection(limit string, route string) {
+	limitRejections.WithLabelValues(limit, route).Inc()
+}
+
+func outcomeLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// MongoMonitor returns a command monitor that records the latency of MongoDB commands.
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "success").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "failure").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+	}
+}
+
+// MetricsMiddleware records the count and latency of HTTP requests by route.
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response, so its status code is recorded
+				c.Error(err)
+			}
+			route := c.Path()
+			// the router leaves the raw request path as the route of requests it found no route for
+			if route == "" || err == echo.ErrNotFound {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().Status)).Inc()
+			httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+// tokenCountCollector counts the registered tokens of every enabled network when scraped.
+type tokenCountCollector struct {
+	service *Service
+}
+
+// RegisterTokenCountCollector exposes the number of registered tokens per network.
+func RegisterTokenCountCollector(service *Service) {
+	prometheus.MustRegister(&tokenCountCollector{service: service})
+}
+
+func (t *tokenCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenCountDesc
+}
+
+func (t *tokenCountCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCountTimeout)
+	defer cancel()
+	for _, network := range EnabledNetworks() {
+		count, err := t.service.CountTokens(ctx, network)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(tokenCountDesc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(tokenCountDesc, prometheus.GaugeValue, float64(count), network)
+	}
+}
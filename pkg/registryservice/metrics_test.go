@@ -0,0 +1,83 @@
+package registryservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRegistrationMetrics(t *testing.T) {
+	service := &stubTokens{tokens: []*registry.IRC30Token{{ID: "0x01", Name: "One", Symbol: "ONE"}}}
+	tests := []struct {
+		name       string
+		body       string
+		wantReason string
+	}{
+		{name: "invalid JSON", body: `{"name":`, wantReason: ReasonInvalidRequest},
+		{name: "name too long", body: `{"ID":"0x02","name":"` + strings.Repeat("a", maxNameLength+1) + `","symbol":"TWO"}`, wantReason: ReasonValidation},
+		{name: "swear word", body: `{"ID":"0x02","name":"abuse","symbol":"TWO"}`, wantReason: ReasonFilter},
+		{name: "invalid logo", body: `{"ID":"0x02","name":"Two","symbol":"TWO","logo":"0xzz"}`, wantReason: ReasonLogo},
+		{name: "name taken", body: `{"ID":"0x02","name":"One","symbol":"TWO"}`, wantReason: ReasonUniqueness},
+		{name: "ID taken", body: `{"ID":"0x01","name":"Two","symbol":"TWO"}`, wantReason: ReasonUniqueness},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := registrations.WithLabelValues("alphanet", OutcomeRejected, test.wantReason)
+			before := testutil.ToFloat64(counter)
+
+			h := &HTTPHandler{service: service, logger: zap.NewNop().Sugar(), filter: NewSwearFilter()}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)), rec)
+			c.SetParamNames("network")
+			c.SetParamValues("alphanet")
+			if err := h.SaveToken(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("registrations with reason %s increased by %v, want 1", test.wantReason, got)
+			}
+		})
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		wantRoute string
+		wantCode  string
+	}{
+		{name: "route template", method: http.MethodGet, path: "/tokens/0x01", wantRoute: "/tokens/:ID", wantCode: "200"},
+		{name: "handler error", method: http.MethodGet, path: "/fail", wantRoute: "/fail", wantCode: "503"},
+		{name: "not found by handler", method: http.MethodGet, path: "/missing/0x01", wantRoute: "/missing/:ID", wantCode: "404"},
+		{name: "unmatched", method: http.MethodGet, path: "/unknown/path", wantRoute: "unmatched", wantCode: "404"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(MetricsMiddleware())
+			e.GET("/tokens/:ID", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+			e.GET("/missing/:ID", func(c echo.Context) error { return c.NoContent(http.StatusNotFound) })
+			e.GET("/fail", func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusServiceUnavailable)
+			})
+
+			counter := httpRequests.WithLabelValues(test.method, test.wantRoute, test.wantCode)
+			before := testutil.ToFloat64(counter)
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(test.method, test.path, nil))
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("requests labeled %s %s %s increased by %v, want 1", test.method, test.wantRoute, test.wantCode, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package registryservice
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const networksCollection = "_networks"
+
+var (
+	Networks = map[string]bool{
+		"alphanet": true,
+		"betanet":  false,
+		"shimmer":  false,
+	}
+	networksMutex sync.RWMutex
+
+	// ErrNetworkNotAllowed is returned for networks that are unknown or disabled.
+	ErrNetworkNotAllowed = errors.New("network not allowed")
+	// ErrInvalidNetworkName is returned for network names that can not be stored.
+	ErrInvalidNetworkName = errors.New("invalid network name")
+
+	// networkNamePattern keeps network names apart from the internal collections, which start with an underscore.
+	networkNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+func validNetworkName(network string) bool {
+	return networkNamePattern.MatchString(network)
+}
+
+func networkAllowed(network string) bool {
+	networksMutex.RLock()
+	defer networksMutex.RUnlock()
+	return Networks[network]
+}
+
+// LoadNetworks returns the known networks and whether they are enabled.
+func LoadNetworks() map[string]bool {
+	networksMutex.RLock()
+	defer networksMutex.RUnlock()
+	result := make(map[string]bool, len(Networks))
+	for network, enabled := range Networks {
+		result[network] = enabled
+	}
+	return result
+}
+
+// EnabledNetworks returns the sorted names of the enabled networks.
+func EnabledNetworks() []string {
+	networksMutex.RLock()
+	defer networksMutex.RUnlock()
+	result := make([]string, 0, len(Networks))
+	for network, enabled := range Networks {
+		if enabled {
+			result = append(result, network)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// SetNetwork enables or disables a network, adding it if unknown.
+func SetNetwork(network string, enabled bool) {
+	networksMutex.Lock()
+	defer networksMutex.Unlock()
+	Networks[network] = enabled
+}
+
+func (s *Service) SaveNetworkSetting(ctx context.Context, setting *registry.NetworkSetting) error {
+	_, err := s.db.Collection(networksCollection).ReplaceOne(ctx, bson.M{"_id": setting.Network}, setting, options.Replace().SetUpsert(true))
+	return errors.Wrap(err, "failed to save network setting into mongo collection")
+}
+
+func (s *Service) LoadNetworkSettings(ctx context.Context) (settings []*registry.NetworkSetting, err error) {
+	settings = make([]*registry.NetworkSetting, 0)
+	cur, err := s.db.Collection(networksCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &settings)
+	return
+}
+
+// NetworkSync applies the network settings admins stored on any instance to the enabled networks of this one.
+// Networks without a stored setting keep their default.
+type NetworkSync struct {
+	service  registry.Service
+	interval time.Duration
+}
+
+func NewNetworkSync(service registry.Service, interval time.Duration) *NetworkSync {
+	return &NetworkSync{service: service, interval: interval}
+}
+
+// Load applies the stored network settings once.
+func (n *NetworkSync) Load(ctx context.Context) error {
+	settings, err := n.service.LoadNetworkSettings(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load network settings")
+	}
+	for _, setting := range settings {
+		SetNetwork(setting.Network, setting.Enabled)
+	}
+	return nil
+}
+
+// Run reloads the stored network settings every interval until ctx is done.
+func (n *NetworkSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.Load(ctx); err != nil {
+				zap.S().Warnw("Failed to sync networks", "error", err)
+			}
+		}
+	}
+}
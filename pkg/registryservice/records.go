@@ -0,0 +1,293 @@
+package registryservice
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// MIMEApplicationJSONLines defines the content type of the token exports.
+	MIMEApplicationJSONLines = "application/x-ndjson"
+	// maxRecordSize defines the maximum size of an imported line, a token with its logos.
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// ExportTokens streams the tokens of a network as JSON Lines, one TokenRecord with its pinned logo per line.
+func (h *HTTPHandler) ExportTokens(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	tokens, err := h.service.LoadTokens(ctx, network)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load tokens")))
+	}
+	// the records are complete before the status is sent, so failures are not hidden in a truncated export
+	records := make([]*registryhttp.TokenRecord, 0, len(tokens))
+	for _, token := range tokens {
+		record := &registryhttp.TokenRecord{
+			Network:            network,
+			IRC30Token:         token,
+			CreatedAt:          optionalTime(token.CreatedAt),
+			UpdatedAt:          optionalTime(token.UpdatedAt),
+			VerifiedAt:         optionalTime(token.VerifiedAt),
+			Provenance:         token.Provenance,
+			VerificationStatus: token.VerificationStatus,
+			Flag:               token.Flag,
+			TrustLevel:         token.TrustLevel,
+		}
+		if token.LogoHash != "" {
+			logo, err := h.service.LoadLogo(ctx, token.LogoHash)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrapf(err, "service failed to load pinned logo of token %s", token.ID)))
+			}
+			record.PinnedLogo = &registryhttp.PinnedLogo{ContentType: logo.ContentType, SourceURL: logo.SourceURL, FetchedAt: logo.FetchedAt, Data: logo.Data}
+		}
+		records = append(records, record)
+	}
+	h.auditor.Record(c, "exportTokens", network, strconv.Itoa(len(records)))
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, MIMEApplicationJSONLines)
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", network+".jsonl"))
+	c.Response().WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(c.Response())
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			Logger(c).Warnw("Export aborted", "network", network, "error", err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ImportTokens imports tokens from JSON Lines of TokenRecords into a network. The conflict query parameter decides
+// what happens to tokens whose ID is registered already: skip, overwrite or fail, the default. With verify set, every
+// imported token is verified against the node again. Nothing is written if any line fails or dryRun is set.
+func (h *HTTPHandler) ImportTokens(c echo.Context) error {
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	conflict := c.QueryParam("conflict")
+	switch conflict {
+	case "":
+		conflict = registryhttp.ImportConflictFail
+	case registryhttp.ImportConflictSkip, registryhttp.ImportConflictOverwrite, registryhttp.ImportConflictFail:
+	default:
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid conflict policy %q, must be skip, overwrite or fail", conflict)))
+	}
+	dryRun, err := boolQueryParam(c, "dryRun")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	verify, err := boolQueryParam(c, "verify")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+
+	response := &registryhttp.ImportResponse{DryRun: dryRun, Results: make([]*registryhttp.ImportResult, 0)}
+	var imports []*registryhttp.TokenRecord
+	var actions []string
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(c.Request().Body)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		result := &registryhttp.ImportResult{Line: line}
+		response.Results = append(response.Results, result)
+		record, action, err := h.planImport(c, network, scanner.Bytes(), conflict, verify, seen)
+		if record != nil {
+			result.ID = record.ID
+			// names and symbols are unique like IDs, their keys are prefixed to keep them apart
+			for _, key := range []string{record.ID, "name:" + record.Name, "symbol:" + record.Symbol} {
+				if _, ok := seen[key]; !ok {
+					seen[key] = line
+				}
+			}
+		}
+		if err != nil {
+			result.Action, result.Error = registryhttp.ImportActionFail, err.Error()
+			response.Failed++
+			continue
+		}
+		result.Action = action
+		switch action {
+		case registryhttp.ImportActionCreate:
+			response.Created++
+		case registryhttp.ImportActionOverwrite:
+			response.Overwritten++
+		case registryhttp.ImportActionSkip:
+			response.Skipped++
+			continue
+		}
+		imports = append(imports, record)
+		actions = append(actions, action)
+	}
+	if err := scanner.Err(); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "failed to read import")))
+	}
+	if dryRun {
+		return c.JSON(http.StatusOK, response)
+	}
+	if response.Failed > 0 {
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	for i, record := range imports {
+		if err := h.importRecord(c, network, record); err != nil {
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrapf(err, "import of token %s failed, earlier tokens were imported", record.ID)))
+		}
+		eventType := registryhttp.EventTokenRegistered
+		if actions[i] == registryhttp.ImportActionOverwrite {
+			eventType = registryhttp.EventTokenUpdated
+		}
+		h.events.Publish(c.Request().Context(), eventType, network, record.IRC30Token)
+	}
+	response.Applied = true
+	h.auditor.Record(c, "importTokens", network, fmt.Sprintf("%d created, %d overwritten", response.Created, response.Overwritten))
+	return c.JSON(http.StatusOK, response)
+}
+
+// planImport parses a line of an import and decides what to do with its token.
+func (h *HTTPHandler) planImport(c echo.Context, network string, line []byte, conflict string, verify bool, seen map[string]int) (*registryhttp.TokenRecord, string, error) {
+	ctx := c.Request().Context()
+	record := &registryhttp.TokenRecord{}
+	if err := json.Unmarshal(line, record); err != nil {
+		return nil, "", errors.Wrap(err, "failed to parse line as JSON into a token record")
+	}
+	if record.IRC30Token == nil || record.ID == "" {
+		return nil, "", errors.New("token ID is missing")
+	}
+	if record.Network != "" && record.Network != network {
+		return record, "", errors.Newf("token belongs to network %s", record.Network)
+	}
+	if previous, ok := seen[record.ID]; ok {
+		return record, "", errors.Newf("token was imported on line %d already", previous)
+	}
+	if record.TrustLevel != "" {
+		if registryhttp.TrustRank(record.TrustLevel) < 0 {
+			return record, "", errors.Newf("invalid trust level %q", record.TrustLevel)
+		}
+		// assigning trust levels needs the scope of SetTrustLevel, whatever the route
+		if identity := AdminIdentity(c); identity == nil || !identity.HasScope(ScopeTrustAdmin) {
+			return record, "", errors.Newf("importing trust levels requires the %s scope", ScopeTrustAdmin)
+		}
+	}
+	// imported tokens pass the same checks as registrations, only the logos they pass are stored
+	if _, err := firstFailure(ctx, StaticChecks(h.filter, record.IRC30Token)); err != nil {
+		return record, "", err
+	}
+	logo, err := NormalizeLogo(record.Logo)
+	if err != nil {
+		return record, "", err
+	}
+	record.Logo = logo
+	if pinned := record.PinnedLogo; pinned != nil {
+		hash := sha256.Sum256(pinned.Data)
+		if hex.EncodeToString(hash[:]) != record.LogoHash {
+			return record, "", errors.New("pinned logo does not match logoHash")
+		}
+		data, err := normalizeLogo(pinned.Data)
+		if err != nil {
+			return record, "", errors.Wrap(err, "invalid pinned logo")
+		}
+		normalized := pinnedLogo(data)
+		pinned.Data, pinned.ContentType = normalized.Data, normalized.ContentType
+		record.LogoHash = normalized.Hash
+	} else if record.LogoHash != "" {
+		if _, err := h.service.LoadLogo(ctx, record.LogoHash); err != nil {
+			return record, "", errors.New("pinned logo is neither part of the record nor stored")
+		}
+	}
+	if _, err := firstFailure(ctx, uniqueNameChecks(h.service, network, record.IRC30Token)); err != nil {
+		return record, "", err
+	}
+	for _, key := range []string{"name:" + record.Name, "symbol:" + record.Symbol} {
+		if previous, ok := seen[key]; ok {
+			return record, "", errors.Newf("token %s was imported on line %d already", key, previous)
+		}
+	}
+
+	action := registryhttp.ImportActionCreate
+	_, err = h.service.LoadToken(ctx, network, record.ID)
+	switch {
+	case err == nil:
+		switch conflict {
+		case registryhttp.ImportConflictSkip:
+			return record, registryhttp.ImportActionSkip, nil
+		case registryhttp.ImportConflictFail:
+			return record, "", errors.New("token is registered already")
+		}
+		action = registryhttp.ImportActionOverwrite
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return record, "", errors.Wrap(err, "service failed to load token")
+	}
+
+	// only verifications of this registry count, the outcome recorded in the file is not trusted
+	record.VerifiedAt = nil
+	record.VerificationStatus = registryhttp.VerificationUnverified
+	if verify {
+		if _, err := h.verifier.Verify(ctx, network, record.IRC30Token); err != nil {
+			return record, "", errors.Wrap(err, "token verification failed")
+		}
+		now := time.Now().UTC()
+		record.VerifiedAt = &now
+		record.VerificationStatus = ""
+	}
+	return record, action, nil
+}
+
+// importRecord saves the token of a record with its pinned logo.
+func (h *HTTPHandler) importRecord(c echo.Context, network string, record *registryhttp.TokenRecord) error {
+	ctx := c.Request().Context()
+	if logo := record.PinnedLogo; logo != nil {
+		if err := h.service.SaveLogo(ctx, &registry.Logo{Hash: record.LogoHash, ContentType: logo.ContentType, Data: logo.Data, SourceURL: logo.SourceURL, FetchedAt: logo.FetchedAt}); err != nil {
+			return err
+		}
+	}
+	token := record.IRC30Token
+	token.CreatedAt = timeValue(record.CreatedAt)
+	token.UpdatedAt = timeValue(record.UpdatedAt)
+	token.VerifiedAt = timeValue(record.VerifiedAt)
+	token.Provenance = record.Provenance
+	token.VerificationStatus = record.VerificationStatus
+	token.Flag = record.Flag
+	token.TrustLevel = record.TrustLevel
+	return h.service.ReplaceToken(ctx, network, token)
+}
+
+func boolQueryParam(c echo.Context, name string) (bool, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, errors.Newf("invalid %s %q, must be true or false", name, param)
+	}
+	return value, nil
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,171 @@
+package registryservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubTokens holds the tokens of a single network, any call it does not implement panics.
+type stubTokens struct {
+	registry.Service
+	tokens []*registry.IRC30Token
+}
+
+func (s *stubTokens) LoadToken(_ context.Context, _ string, ID string) (*registry.IRC30Token, error) {
+	return s.find(func(token *registry.IRC30Token) bool { return token.ID == ID })
+}
+
+func (s *stubTokens) FindTokenByName(_ context.Context, _ string, name string) (*registry.IRC30Token, error) {
+	return s.find(func(token *registry.IRC30Token) bool { return token.Name == name })
+}
+
+func (s *stubTokens) FindTokenBySymbol(_ context.Context, _ string, symbol string) (*registry.IRC30Token, error) {
+	return s.find(func(token *registry.IRC30Token) bool { return token.Symbol == symbol })
+}
+
+func (s *stubTokens) LoadLogo(context.Context, string) (*registry.Logo, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *stubTokens) find(match func(token *registry.IRC30Token) bool) (*registry.IRC30Token, error) {
+	for _, token := range s.tokens {
+		if match(token) {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func TestPlanImportLogos(t *testing.T) {
+	svg := []byte(`<svg width="10" height="10" onload="alert(1)"><script>alert(2)</script></svg>`)
+	html := []byte(`<html><script>alert(1)</script></html>`)
+	tests := []struct {
+		name    string
+		record  *registryhttp.TokenRecord
+		wantErr bool
+	}{
+		{name: "inline svg", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { r.Logo = EncodeLogo(svg) })},
+		{name: "inline html", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { r.Logo = EncodeLogo(html) }), wantErr: true},
+		{name: "pinned svg", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { pin(r, svg, LogoTypePNG) })},
+		{name: "pinned html", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { pin(r, html, "text/html") }), wantErr: true},
+		{name: "pinned logo of another hash", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) {
+			pin(r, svg, LogoTypeSVG)
+			r.LogoHash = strings.Repeat("0", 64)
+		}), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &HTTPHandler{service: &stubTokens{}, filter: NewSwearFilter()}
+			record, _, err := h.planImport(importContext(), "alphanet", testLine(t, test.record), registryhttp.ImportConflictFail, false, make(map[string]int))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("planImport() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planImport() error = %v", err)
+			}
+			var logo []byte
+			if record.PinnedLogo != nil {
+				logo = record.PinnedLogo.Data
+			} else if logo, err = DecodeLogo(record.Logo); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(logo), "alert") {
+				t.Errorf("imported logo %s was not sanitized", logo)
+			}
+			if pinned := record.PinnedLogo; pinned != nil {
+				hash := sha256.Sum256(pinned.Data)
+				if record.LogoHash != hex.EncodeToString(hash[:]) || pinned.ContentType != LogoTypeSVG {
+					t.Errorf("pinned logo has hash %s and content type %s, want the hash and type of the sanitized logo", record.LogoHash, pinned.ContentType)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanImportUniqueness(t *testing.T) {
+	service := &stubTokens{tokens: []*registry.IRC30Token{{ID: "0x01", Name: "One", Symbol: "ONE"}}}
+	tests := []struct {
+		name    string
+		record  *registryhttp.TokenRecord
+		wantErr bool
+	}{
+		{name: "new token", record: testRecord("0x02", "Two", nil)},
+		{name: "overwritten token", record: testRecord("0x01", "One", nil)},
+		{name: "name of another token", record: testRecord("0x02", "One", func(r *registryhttp.TokenRecord) { r.Symbol = "TWO" }), wantErr: true},
+		{name: "symbol of another token", record: testRecord("0x02", "Two", func(r *registryhttp.TokenRecord) { r.Symbol = "ONE" }), wantErr: true},
+		{name: "filtered name", record: testRecord("0x02", "fuck", nil), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &HTTPHandler{service: service, filter: NewSwearFilter()}
+			_, _, err := h.planImport(importContext(), "alphanet", testLine(t, test.record), registryhttp.ImportConflictOverwrite, false, make(map[string]int))
+			if (err != nil) != test.wantErr {
+				t.Errorf("planImport() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportTokensDuplicateNames(t *testing.T) {
+	lines := string(testLine(t, testRecord("0x01", "One", nil))) + "\n" +
+		string(testLine(t, testRecord("0x02", "One", func(r *registryhttp.TokenRecord) { r.Symbol = "TWO" })))
+	req := httptest.NewRequest(http.MethodPost, "/admin/alphanet/tokens/import?dryRun=true", strings.NewReader(lines))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("network")
+	c.SetParamValues("alphanet")
+
+	h := &HTTPHandler{service: &stubTokens{}, filter: NewSwearFilter()}
+	if err := h.ImportTokens(c); err != nil {
+		t.Fatal(err)
+	}
+	response := &registryhttp.ImportResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Failed != 1 || response.Results[1].Action != registryhttp.ImportActionFail {
+		t.Errorf("import of two tokens with the same name failed %d lines, want the second one", response.Failed)
+	}
+}
+
+func testRecord(ID string, name string, modify func(record *registryhttp.TokenRecord)) *registryhttp.TokenRecord {
+	record := &registryhttp.TokenRecord{IRC30Token: &registry.IRC30Token{ID: ID, Name: name, Symbol: strings.ToUpper(name), MaxSupply: "1000"}}
+	if modify != nil {
+		modify(record)
+	}
+	return record
+}
+
+func pin(record *registryhttp.TokenRecord, logo []byte, contentType string) {
+	hash := sha256.Sum256(logo)
+	record.LogoHash = hex.EncodeToString(hash[:])
+	record.PinnedLogo = &registryhttp.PinnedLogo{ContentType: contentType, Data: logo}
+}
+
+func testLine(t *testing.T, record *registryhttp.TokenRecord) []byte {
+	t.Helper()
+	line, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func importContext() echo.Context {
+	return echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+}
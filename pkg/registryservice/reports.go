@@ -0,0 +1,299 @@
+package registryservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	reportsCollection = "_reports"
+
+	// maxReportTextLength defines the maximum length of the text of a report in characters.
+	maxReportTextLength = 2000
+	// maxNoteLength defines the maximum length of the note an admin triages a report with in characters.
+	maxNoteLength = 2000
+	// defaultReportLimit and maxReportLimit define how many reports are listed by default and at most.
+	defaultReportLimit = 500
+	maxReportLimit     = 5000
+)
+
+// ErrReportNotOpen is returned if a report was resolved or dismissed already.
+var ErrReportNotOpen = errors.New("report was triaged already")
+
+func (s *Service) SaveReport(ctx context.Context, report *registry.Report) error {
+	_, err := s.db.Collection(reportsCollection).InsertOne(ctx, report)
+	return errors.Wrap(err, "failed to insert report into mongo collection")
+}
+
+func (s *Service) LoadReport(ctx context.Context, ID string) (report *registry.Report, err error) {
+	// Query One
+	result := s.db.Collection(reportsCollection).FindOne(ctx, bson.M{"_id": ID})
+	err = result.Decode(&report)
+	return
+}
+
+// LoadReports loads the latest reports, newest first, optionally only those of network or with status.
+func (s *Service) LoadReports(ctx context.Context, network string, status string, limit int64) (reports []*registry.Report, err error) {
+	filter := bson.M{}
+	if network != "" {
+		filter["network"] = network
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	reports = make([]*registry.Report, 0)
+	cur, err := s.db.Collection(reportsCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(limit))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &reports)
+	return
+}
+
+// ResolveReport resolves or dismisses an open report. It returns ErrReportNotOpen if the report was triaged already.
+func (s *Service) ResolveReport(ctx context.Context, ID string, status string, resolution *registry.ReportResolution) error {
+	result, err := s.db.Collection(reportsCollection).UpdateOne(ctx,
+		bson.M{"_id": ID, "status": registryhttp.ReportOpen},
+		bson.M{"$set": bson.M{"status": status, "resolution": resolution}})
+	if err != nil {
+		return errors.Wrap(err, "failed to update report in mongo collection")
+	}
+	if result.MatchedCount == 0 {
+		return ErrReportNotOpen
+	}
+	return nil
+}
+
+// ResolveTokenReports resolves every open report of a token and returns how many there were.
+func (s *Service) ResolveTokenReports(ctx context.Context, network string, tokenID string, resolution *registry.ReportResolution) (int64, error) {
+	result, err := s.db.Collection(reportsCollection).UpdateMany(ctx,
+		bson.M{"network": network, "tokenId": tokenID, "status": registryhttp.ReportOpen},
+		bson.M{"$set": bson.M{"status": registryhttp.ReportResolved, "resolution": resolution}})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to update reports in mongo collection")
+	}
+	return result.ModifiedCount, nil
+}
+
+// ReportToken receives an abuse report of a registered token. The text passes the swear filter like token metadata.
+func (h *HTTPHandler) ReportToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	var req *registryhttp.CreateReportRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil || req == nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("failed to parse request body as JSON into a report")))
+	}
+	if !subscribed(registryhttp.ReportReasons, req.Reason) || req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("unknown report reason %q", req.Reason)))
+	}
+	if req.Reason == registryhttp.ReportReasonOther && req.Text == "" {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("reports for other reasons need a text")))
+	}
+	if utf8.RuneCountInString(req.Text) > maxReportTextLength {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("report text must not exceed %d characters", maxReportTextLength)))
+	}
+	if err := filterCheck("textFilter", h.filter, req.Text).Run(ctx); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("report text contains forbidden words")))
+	}
+	ID := c.Param("ID")
+	if _, err := h.service.LoadToken(ctx, network, ID); err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load IRC30Token")))
+	}
+
+	reportID, err := randomString(8)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+	}
+	report := &registry.Report{
+		ID:         reportID,
+		Network:    network,
+		TokenID:    ID,
+		Reason:     req.Reason,
+		Text:       req.Text,
+		Status:     registryhttp.ReportOpen,
+		ReportedBy: ClientIP(c),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := h.reports.SaveReport(ctx, report); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save report")))
+	}
+	Logger(c).Infow("Token reported", "network", network, "token", ID, "report", reportID, "reason", req.Reason)
+	return c.JSON(http.StatusCreated, &registryhttp.CreateReportResponse{ID: reportID, Status: report.Status})
+}
+
+// LoadReports returns the latest reports grouped by token, the tokens with the most reports first. The status query
+// parameter selects open reports by default, network restricts them to a network.
+func (h *HTTPHandler) LoadReports(c echo.Context) error {
+	ctx := c.Request().Context()
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = registryhttp.ReportOpen
+	case registryhttp.ReportOpen, registryhttp.ReportResolved, registryhttp.ReportDismissed:
+	default:
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid status %q, must be open, resolved or dismissed", status)))
+	}
+	network := c.QueryParam("network")
+	if network != "" && !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	limit := int64(defaultReportLimit)
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || parsed <= 0 || parsed > maxReportLimit {
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("limit must be between 1 and %d", maxReportLimit)))
+		}
+		limit = parsed
+	}
+	reports, err := h.reports.LoadReports(ctx, network, status, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load reports")))
+	}
+
+	// reports are loaded newest first, so the groups keep that order within
+	groups := make([]*registryhttp.ReportGroup, 0)
+	index := make(map[string]*registryhttp.ReportGroup)
+	for _, report := range reports {
+		key := report.Network + "/" + report.TokenID
+		group, ok := index[key]
+		if !ok {
+			group = &registryhttp.ReportGroup{Network: report.Network, TokenID: report.TokenID, Reports: make([]*registry.Report, 0)}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.Reports = append(group.Reports, report)
+	}
+	for _, group := range groups {
+		token, err := h.service.LoadToken(ctx, group.Network, group.TokenID)
+		switch {
+		case err == nil:
+			group.Name, group.Symbol, group.Registered, group.Flag = token.Name, token.Symbol, true, token.Flag
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load reported token")))
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Reports) > len(groups[j].Reports) })
+	return c.JSON(http.StatusOK, groups)
+}
+
+func (h *HTTPHandler) LoadReport(c echo.Context) error {
+	report, err := h.reports.LoadReport(c.Request().Context(), c.Param("reportID"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load report")))
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// ResolveReport confirms a report. Flagging the token marks it in API v2 and the token list with a link to the
+// report, removing deletes it, which also requires the tokens:delete scope. Either resolves the other open reports
+// of the token as well.
+func (h *HTTPHandler) ResolveReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	req, err := parseResolveReportRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	switch req.Action {
+	case "":
+		req.Action = registryhttp.ReportActionNone
+	case registryhttp.ReportActionNone, registryhttp.ReportActionFlag:
+	case registryhttp.ReportActionRemove:
+		if !AdminIdentity(c).HasScope(ScopeTokensDelete) {
+			return c.JSON(http.StatusForbidden, errorResponse(c, errors.Newf("removing a token requires the %s scope", ScopeTokensDelete)))
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid action %q, must be none, flag or remove", req.Action)))
+	}
+	report, err := h.reports.LoadReport(ctx, c.Param("reportID"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load report")))
+	}
+	if report.Status != registryhttp.ReportOpen {
+		return c.JSON(http.StatusConflict, errorResponse(c, ErrReportNotOpen))
+	}
+
+	resolution := &registry.ReportResolution{Action: req.Action, Note: req.Note, ResolvedBy: AdminIdentity(c).String(), ResolvedAt: time.Now().UTC()}
+	if req.Action != registryhttp.ReportActionNone {
+		token, err := h.service.LoadToken(ctx, report.Network, report.TokenID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load reported token")))
+		}
+		target := report.TokenID + " report " + report.ID
+		if req.Action == registryhttp.ReportActionFlag {
+			token.Flag = &registry.TokenFlag{Reason: report.Reason, ReportID: report.ID, FlaggedAt: resolution.ResolvedAt}
+			if err := h.service.FlagToken(ctx, report.Network, token.ID, token.Flag); err != nil {
+				return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to flag token")))
+			}
+			h.auditor.Record(c, "flagToken", report.Network, target)
+			h.events.Publish(ctx, registryhttp.EventTokenFlagged, report.Network, token)
+		} else {
+			if err := h.service.DeleteTokenByID(ctx, report.Network, token.ID); err != nil {
+				return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to delete the IRC30Token")))
+			}
+			h.auditor.Record(c, "removeToken", report.Network, target)
+			h.events.Publish(ctx, registryhttp.EventTokenDeleted, report.Network, token)
+		}
+		if _, err := h.reports.ResolveTokenReports(ctx, report.Network, report.TokenID, resolution); err != nil {
+			return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to resolve reports")))
+		}
+	} else if err := h.reports.ResolveReport(ctx, report.ID, registryhttp.ReportResolved, resolution); err != nil {
+		return h.respondTriageError(c, err)
+	}
+	h.auditor.Record(c, "resolveReport", report.Network, report.ID)
+	return h.LoadReport(c)
+}
+
+// DismissReport rejects a report, leaving the token as is.
+func (h *HTTPHandler) DismissReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	req, err := parseResolveReportRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	report, err := h.reports.LoadReport(ctx, c.Param("reportID"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load report")))
+	}
+	resolution := &registry.ReportResolution{Action: registryhttp.ReportActionNone, Note: req.Note, ResolvedBy: AdminIdentity(c).String(), ResolvedAt: time.Now().UTC()}
+	if err := h.reports.ResolveReport(ctx, report.ID, registryhttp.ReportDismissed, resolution); err != nil {
+		return h.respondTriageError(c, err)
+	}
+	h.auditor.Record(c, "dismissReport", report.Network, report.ID)
+	return h.LoadReport(c)
+}
+
+func (h *HTTPHandler) respondTriageError(c echo.Context, err error) error {
+	if errors.Is(err, ErrReportNotOpen) {
+		return c.JSON(http.StatusConflict, errorResponse(c, err))
+	}
+	return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to update report")))
+}
+
+// parseResolveReportRequest parses the optional body of a triage request.
+func parseResolveReportRequest(c echo.Context) (*registryhttp.ResolveReportRequest, error) {
+	req := &registryhttp.ResolveReportRequest{}
+	if err := json.NewDecoder(c.Request().Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "failed to parse request body as JSON into a triage")
+	}
+	if utf8.RuneCountInString(req.Note) > maxNoteLength {
+		return nil, errors.Newf("note must not exceed %d characters", maxNoteLength)
+	}
+	return req, nil
+}
@@ -0,0 +1,123 @@
+package registryservice
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderRequestID carries the ID of a request, it is propagated if the client sets a valid one.
+	HeaderRequestID = "X-Request-ID"
+
+	requestIDContextKey = "requestID"
+	clientIPContextKey  = "clientIP"
+)
+
+type loggerContextKey struct{}
+
+// requestIDPattern restricts propagated request IDs, so they can not inject content into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware assigns every request an ID, taken from X-Request-ID or generated, returns it in the response
+// header and attaches a logger with the ID to the request context.
+func RequestIDMiddleware(logger *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ID := req.Header.Get(HeaderRequestID)
+			if !requestIDPattern.MatchString(ID) {
+				var err error
+				if ID, err = randomString(16); err != nil {
+					return err
+				}
+			}
+			c.Set(requestIDContextKey, ID)
+			c.Response().Header().Set(HeaderRequestID, ID)
+			ctx := context.WithValue(req.Context(), loggerContextKey{}, logger.With("requestID", ID))
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// RequestID returns the ID of the request, empty if none was assigned.
+func RequestID(c echo.Context) string {
+	ID, _ := c.Get(requestIDContextKey).(string)
+	return ID
+}
+
+// ContextLogger returns the logger of the request ctx belongs to, or the global logger outside of requests.
+func ContextLogger(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return zap.S()
+}
+
+// Logger returns the logger of the request.
+func Logger(c echo.Context) *zap.SugaredLogger {
+	return ContextLogger(c.Request().Context())
+}
+
+// AccessLogMiddleware logs every request once it was handled. It must run after RequestIDMiddleware.
+func AccessLogMiddleware(trustProxyHeaders bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			c.Set(clientIPContextKey, clientIP(c, trustProxyHeaders))
+			if err := next(c); err != nil {
+				// let the error handler write the response, so its status code is logged
+				c.Error(err)
+			}
+
+			fields := []interface{}{
+				"method", c.Request().Method,
+				"route", c.Path(),
+				"status", c.Response().Status,
+				"latency", time.Since(start),
+				"remoteIP", ClientIP(c),
+			}
+			if network := c.Param("network"); network != "" {
+				fields = append(fields, "network", network)
+			}
+			if identity := AdminIdentity(c); identity != nil {
+				fields = append(fields, "admin", identity.String())
+			}
+			Logger(c).Infow("Request", fields...)
+			return nil
+		}
+	}
+}
+
+// ClientIP returns the IP of the client as determined by AccessLogMiddleware, or the remote address without it.
+func ClientIP(c echo.Context) string {
+	if ip, ok := c.Get(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return clientIP(c, false)
+}
+
+// clientIP returns the IP of the client. Proxy headers are only used if trusted, as clients could set them otherwise.
+func clientIP(c echo.Context, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		return c.RealIP()
+	}
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
+
+// errorResponse creates the response to a failed request, carrying the request ID.
+func errorResponse(c echo.Context, err error) *registryhttp.ErrorResponse {
+	response := registryhttp.NewErrorResponse(err)
+	response.RequestID = RequestID(c)
+	return response
+}
@@ -0,0 +1,88 @@
+package registryservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	iotago "github.com/iotaledger/iota.go/v3"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// Reverifier verifies the registered tokens against the ledger again and records and publishes the tokens whose
+// verification status changed. It runs on the instance holding its lease only, so each change is published once.
+type Reverifier struct {
+	service  registry.Service
+	verifier *Verifier
+	events   *EventFeed
+	lease    *WorkerLease
+	interval time.Duration
+}
+
+func NewReverifier(service registry.Service, leases registry.LeaseService, verifier *Verifier, events *EventFeed, interval time.Duration) *Reverifier {
+	return &Reverifier{service: service, verifier: verifier, events: events, lease: NewWorkerLease(leases, "reverifier", interval), interval: interval}
+}
+
+// Run verifies the tokens of the enabled networks every interval until ctx is cancelled. Tokens are verified one at
+// a time, so the node is queried no more than by a single verification.
+func (r *Reverifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.lease.Claim(ctx) {
+			continue
+		}
+		for _, network := range EnabledNetworks() {
+			if err := r.reverify(ctx, network); err != nil {
+				ContextLogger(ctx).Warnw("Failed to verify tokens", "network", network, "error", err)
+			}
+		}
+	}
+}
+
+// reverify verifies every token of network. Tokens whose foundry can not be loaded keep their status.
+func (r *Reverifier) reverify(ctx context.Context, network string) error {
+	tokens, err := r.service.LoadTokens(ctx, network)
+	if err != nil {
+		return errors.Wrap(err, "service failed to load tokens")
+	}
+	for _, token := range tokens {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		foundry, err := r.verifier.Foundry(ctx, network, token.ID)
+		var scheme *iotago.SimpleTokenScheme
+		if err == nil {
+			scheme, err = SimpleTokenScheme(foundry.Output)
+		}
+		if err != nil {
+			ContextLogger(ctx).Debugw("Failed to load foundry", "network", network, "token", token.ID, "error", err)
+			continue
+		}
+		if scheme.MaximumSupply.String() != token.MaxSupply {
+			r.record(ctx, network, token, registryhttp.VerificationMismatch, time.Time{})
+			continue
+		}
+		r.record(ctx, network, token, registryhttp.VerificationVerified, time.Now().UTC())
+	}
+	return nil
+}
+
+// record stores the verification status of a token and publishes it, if it changed.
+func (r *Reverifier) record(ctx context.Context, network string, token *registry.IRC30Token, status string, verifiedAt time.Time) {
+	if verificationStatus(token) == status {
+		return
+	}
+	if err := r.service.UpdateVerification(ctx, network, token.ID, status, verifiedAt); err != nil {
+		ContextLogger(ctx).Warnw("Failed to record verification status", "network", network, "token", token.ID, "error", err)
+		return
+	}
+	token.VerificationStatus = status
+	r.events.Publish(ctx, registryhttp.EventTokenVerification, network, token)
+}
@@ -2,11 +2,19 @@ package registryservice
 
 import (
 	"context"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/lzpap/token-verifier/pkg/registry"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// logosCollection holds the pinned logos. Internal collections start with an underscore, which
+	// network names can not.
+	logosCollection = "_logos"
 )
 
 type Service struct {
@@ -44,6 +52,27 @@ func (s *Service) SaveToken(ctx context.Context, network string, asset *registry
 	return errors.Wrap(err, "failed to insert assets into mongo collection")
 }
 
+// ReplaceToken replaces the token with the same ID, inserting it if there is none.
+func (s *Service) ReplaceToken(ctx context.Context, network string, asset *registry.IRC30Token) error {
+	_, err := s.db.Collection(network).ReplaceOne(ctx, bson.M{"ID": asset.ID}, asset, options.Replace().SetUpsert(true))
+	return errors.Wrap(err, "failed to replace asset in mongo collection")
+}
+
+// UpdateVerification records the verification status of a token, and when it was verified if verifiedAt is set.
+func (s *Service) UpdateVerification(ctx context.Context, network string, ID string, status string, verifiedAt time.Time) error {
+	update := bson.M{"verificationStatus": status}
+	if !verifiedAt.IsZero() {
+		update["verifiedAt"] = verifiedAt
+	}
+	_, err := s.db.Collection(network).UpdateOne(ctx, bson.M{"ID": ID}, bson.M{"$set": update})
+	return errors.Wrap(err, "failed to update verification in mongo collection")
+}
+
+func (s *Service) FlagToken(ctx context.Context, network string, ID string, flag *registry.TokenFlag) error {
+	_, err := s.db.Collection(network).UpdateOne(ctx, bson.M{"ID": ID}, bson.M{"$set": bson.M{"flag": flag}})
+	return errors.Wrap(err, "failed to flag token in mongo collection")
+}
+
 func (s *Service) LoadTokens(ctx context.Context, network string, IDs ...string) (assets []*registry.IRC30Token, err error) {
 	var cur *mongo.Cursor
 	assets = make([]*registry.IRC30Token, 0)
@@ -94,6 +123,10 @@ func (s *Service) LoadToken(ctx context.Context, network string, ID string) (ass
 	return
 }
 
+func (s *Service) CountTokens(ctx context.Context, network string) (int64, error) {
+	return s.db.Collection(network).CountDocuments(ctx, bson.M{})
+}
+
 func (s *Service) DeleteTokenByID(ctx context.Context, network string, ID string) (err error) {
 	// Delete all
 	_, err = s.db.Collection(network).DeleteMany(ctx, bson.M{"ID": ID})
@@ -105,3 +138,19 @@ func (s *Service) DeleteTokenByName(ctx context.Context, network string, name st
 	_, err = s.db.Collection(network).DeleteMany(ctx, bson.M{"name": name})
 	return
 }
+
+func (s *Service) SaveLogo(ctx context.Context, logo *registry.Logo) error {
+	_, err := s.db.Collection(logosCollection).InsertOne(ctx, logo)
+	// logos are content-addressed, so an existing document with the same hash holds the same logo
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return errors.Wrap(err, "failed to insert logo into mongo collection")
+}
+
+func (s *Service) LoadLogo(ctx context.Context, hash string) (logo *registry.Logo, err error) {
+	// Query One
+	result := s.db.Collection(logosCollection).FindOne(ctx, bson.M{"_id": hash})
+	err = result.Decode(&logo)
+	return
+}
@@ -0,0 +1,372 @@
+package registryservice
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	snapshotsCollection = "_snapshots"
+	// snapshotTimeout defines how long taking the snapshot of a network may take.
+	snapshotTimeout = time.Minute
+)
+
+// ErrSnapshotExists is returned if a snapshot with the same sequence was saved, e.g. by another instance.
+var ErrSnapshotExists = errors.New("snapshot already exists")
+
+func (s *Service) SaveSnapshot(ctx context.Context, snapshot *registry.Snapshot) error {
+	_, err := s.db.Collection(snapshotsCollection).InsertOne(ctx, snapshot)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrSnapshotExists
+	}
+	return errors.Wrap(err, "failed to insert snapshot into mongo collection")
+}
+
+func (s *Service) LoadSnapshot(ctx context.Context, network string, sequence uint64) (snapshot *registry.Snapshot, err error) {
+	// Query One
+	result := s.db.Collection(snapshotsCollection).FindOne(ctx, bson.M{"_id": snapshotID(network, sequence)})
+	err = result.Decode(&snapshot)
+	return
+}
+
+// LoadLatestSnapshot loads the snapshot of a network with the highest sequence.
+func (s *Service) LoadLatestSnapshot(ctx context.Context, network string) (snapshot *registry.Snapshot, err error) {
+	result := s.db.Collection(snapshotsCollection).FindOne(ctx, bson.M{"network": network}, options.FindOne().SetSort(bson.M{"sequence": -1}))
+	err = result.Decode(&snapshot)
+	return
+}
+
+// DeleteSnapshots deletes the snapshots of a network with a sequence lower than before.
+func (s *Service) DeleteSnapshots(ctx context.Context, network string, before uint64) (err error) {
+	_, err = s.db.Collection(snapshotsCollection).DeleteMany(ctx, bson.M{"network": network, "sequence": bson.M{"$lt": before}})
+	return
+}
+
+func snapshotID(network string, sequence uint64) string {
+	return fmt.Sprintf("%s/%d", network, sequence)
+}
+
+// LoadSigningKey reads the Ed25519 private key snapshots are signed with from a PEM encoded PKCS #8 file, as created
+// by `openssl genpkey -algorithm ed25519`.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read signing key")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse signing key")
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Newf("signing key is a %T, not an Ed25519 key", key)
+	}
+	return signingKey, nil
+}
+
+// Snapshotter periodically takes signed snapshots of the registry of every enabled network and keeps the latest
+// ones. It runs on the instance holding its lease only, so the instances do not race for the snapshot sequence.
+type Snapshotter struct {
+	service   *Service
+	key       ed25519.PrivateKey
+	lease     *WorkerLease
+	interval  time.Duration
+	retention uint64
+}
+
+func NewSnapshotter(service *Service, key ed25519.PrivateKey, interval time.Duration, retention uint64) *Snapshotter {
+	return &Snapshotter{service: service, key: key, lease: NewWorkerLease(service, "snapshotter", interval), interval: interval, retention: retention}
+}
+
+// Run takes snapshots on start and then every interval until ctx is cancelled.
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if s.lease.Claim(ctx) {
+			for _, network := range EnabledNetworks() {
+				if err := s.snapshot(ctx, network); err != nil {
+					ContextLogger(ctx).Warnw("Failed to take snapshot", "network", network, "error", err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot signs the tokens of a network as the next snapshot, unless they did not change since the latest one, and
+// deletes the snapshots beyond the retention.
+func (s *Snapshotter) snapshot(ctx context.Context, network string) error {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	var sequence uint64 = 1
+	latest, err := s.service.LoadLatestSnapshot(ctx, network)
+	switch {
+	case err == nil:
+		sequence = latest.Sequence + 1
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return errors.Wrap(err, "service failed to load latest snapshot")
+	}
+	tokens, err := s.service.LoadTokens(ctx, network)
+	if err != nil {
+		return errors.Wrap(err, "service failed to load tokens")
+	}
+	for _, token := range tokens {
+		if err := s.referenceLogo(ctx, token); err != nil {
+			return err
+		}
+	}
+
+	tree, err := registryhttp.NewTokenMerkleTree(tokens)
+	if err != nil {
+		return err
+	}
+	root := hex.EncodeToString(tree.Root())
+	if latest != nil && latestRoot(latest) == root {
+		// the tokens did not change, the latest snapshot still holds
+		return nil
+	}
+	now := time.Now().UTC()
+	data, err := canonicalJSON(&registryhttp.SnapshotContent{Network: network, Sequence: sequence, Timestamp: now, Tokens: tokens, MerkleRoot: root})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode snapshot")
+	}
+	rootData, err := canonicalJSON(&registryhttp.MerkleRoot{Network: network, Sequence: sequence, Timestamp: now, Root: root, Tokens: len(tokens)})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode Merkle root")
+	}
+	snapshot := &registry.Snapshot{
+		ID:            snapshotID(network, sequence),
+		Network:       network,
+		Sequence:      sequence,
+		Timestamp:     now,
+		Data:          data,
+		Signature:     ed25519.Sign(s.key, data),
+		PublicKey:     s.key.Public().(ed25519.PublicKey),
+		Root:          rootData,
+		RootSignature: ed25519.Sign(s.key, rootData),
+	}
+	if err := s.service.SaveSnapshot(ctx, snapshot); err != nil {
+		if errors.Is(err, ErrSnapshotExists) {
+			// another instance took this snapshot
+			return nil
+		}
+		return errors.Wrap(err, "service failed to save snapshot")
+	}
+	ContextLogger(ctx).Infow("Took snapshot", "network", network, "sequence", sequence, "tokens", len(tokens))
+
+	if sequence > s.retention {
+		if err := s.service.DeleteSnapshots(ctx, network, sequence-s.retention+1); err != nil {
+			return errors.Wrap(err, "service failed to delete old snapshots")
+		}
+	}
+	return nil
+}
+
+// referenceLogo pins the inline logo of token and replaces it by the hash of the pinned logo, which keeps the logo
+// data out of the snapshots. The hash commits to the logo, which is served at /logos/:hash.
+func (s *Snapshotter) referenceLogo(ctx context.Context, token *registry.IRC30Token) error {
+	if token.Logo == "" {
+		return nil
+	}
+	data, err := DecodeLogo(token.Logo)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decode logo of token %s", token.ID)
+	}
+	logo := pinnedLogo(data)
+	if err := s.service.SaveLogo(ctx, logo); err != nil {
+		return errors.Wrap(err, "service failed to save logo")
+	}
+	token.Logo = ""
+	token.LogoHash = logo.Hash
+	return nil
+}
+
+// latestRoot returns the hex encoded Merkle root of snapshot, empty if it predates the Merkle roots.
+func latestRoot(snapshot *registry.Snapshot) string {
+	root := &registryhttp.MerkleRoot{}
+	if len(snapshot.Root) == 0 || json.Unmarshal(snapshot.Root, root) != nil {
+		return ""
+	}
+	return root.Root
+}
+
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return registryhttp.CanonicalJSON(data)
+}
+
+// SnapshotHTTPHandler serves the signed registry snapshots, their Merkle roots and inclusion proofs.
+type SnapshotHTTPHandler struct {
+	snapshots registry.SnapshotService
+	// trees caches the Merkle tree of the latest snapshot of each network.
+	trees      map[string]*snapshotTree
+	treesMutex sync.Mutex
+}
+
+type snapshotTree struct {
+	snapshotID string
+	tokens     map[string]*registry.IRC30Token
+	tree       *registryhttp.MerkleTree
+}
+
+func NewSnapshotHTTPHandler(snapshots registry.SnapshotService) *SnapshotHTTPHandler {
+	return &SnapshotHTTPHandler{snapshots: snapshots, trees: make(map[string]*snapshotTree)}
+}
+
+// LoadLatestSnapshot serves the latest snapshot of a network.
+func (h *SnapshotHTTPHandler) LoadLatestSnapshot(c echo.Context) error {
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	snapshot, err := h.snapshots.LoadLatestSnapshot(c.Request().Context(), network)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load snapshot")))
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=60")
+	return c.JSON(http.StatusOK, signedSnapshot(snapshot))
+}
+
+// LoadSnapshot serves a snapshot of a network by its sequence. Snapshots never change, so they are cached forever.
+func (h *SnapshotHTTPHandler) LoadSnapshot(c echo.Context) error {
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	sequence, err := strconv.ParseUint(c.Param("sequence"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid snapshot sequence %q", c.Param("sequence"))))
+	}
+	snapshot, err := h.snapshots.LoadSnapshot(c.Request().Context(), network, sequence)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load snapshot")))
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	return c.JSON(http.StatusOK, signedSnapshot(snapshot))
+}
+
+// LoadRoot serves the signed Merkle root of the latest snapshot of a network.
+func (h *SnapshotHTTPHandler) LoadRoot(c echo.Context) error {
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	snapshot, err := h.latestRootSnapshot(c.Request().Context(), network)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, err))
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=60")
+	return c.JSON(http.StatusOK, signedRoot(snapshot))
+}
+
+// LoadProof serves the inclusion proof of a token in the signed Merkle root of the latest snapshot of a network.
+// Tokens registered since then can not be proven until the next snapshot.
+func (h *SnapshotHTTPHandler) LoadProof(c echo.Context) error {
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	ID := c.Param("ID")
+	snapshot, err := h.latestRootSnapshot(c.Request().Context(), network)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, err))
+	}
+	tree, err := h.tree(snapshot)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+	}
+	steps, ok := tree.tree.Proof(ID)
+	if !ok {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Newf("token %s is not part of snapshot %d", ID, snapshot.Sequence)))
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=60")
+	return c.JSON(http.StatusOK, &registryhttp.InclusionProof{Token: tree.tokens[ID], Steps: steps, Root: signedRoot(snapshot)})
+}
+
+// latestRootSnapshot loads the latest snapshot of a network, failing if it predates the Merkle roots.
+func (h *SnapshotHTTPHandler) latestRootSnapshot(ctx context.Context, network string) (*registry.Snapshot, error) {
+	snapshot, err := h.snapshots.LoadLatestSnapshot(ctx, network)
+	if err != nil {
+		return nil, errors.Wrap(err, "service failed to load snapshot")
+	}
+	if len(snapshot.Root) == 0 {
+		return nil, errors.Newf("snapshot %d has no Merkle root", snapshot.Sequence)
+	}
+	return snapshot, nil
+}
+
+// tree returns the Merkle tree of snapshot, built from its tokens on first use.
+func (h *SnapshotHTTPHandler) tree(snapshot *registry.Snapshot) (*snapshotTree, error) {
+	h.treesMutex.Lock()
+	defer h.treesMutex.Unlock()
+	if cached, ok := h.trees[snapshot.Network]; ok && cached.snapshotID == snapshot.ID {
+		return cached, nil
+	}
+
+	content := &registryhttp.SnapshotContent{}
+	if err := json.Unmarshal(snapshot.Data, content); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot")
+	}
+	tree, err := registryhttp.NewTokenMerkleTree(content.Tokens)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(tree.Root()) != content.MerkleRoot {
+		return nil, errors.Newf("Merkle root of snapshot %d does not match its tokens", snapshot.Sequence)
+	}
+	cached := &snapshotTree{snapshotID: snapshot.ID, tokens: make(map[string]*registry.IRC30Token, len(content.Tokens)), tree: tree}
+	for _, token := range content.Tokens {
+		cached.tokens[token.ID] = token
+	}
+	h.trees[snapshot.Network] = cached
+	return cached, nil
+}
+
+func signedRoot(snapshot *registry.Snapshot) *registryhttp.SignedRoot {
+	return &registryhttp.SignedRoot{
+		Root:      snapshot.Root,
+		Algorithm: registryhttp.SnapshotAlgorithm,
+		PublicKey: hex.EncodeToString(snapshot.PublicKey),
+		Signature: hex.EncodeToString(snapshot.RootSignature),
+	}
+}
+
+func signedSnapshot(snapshot *registry.Snapshot) *registryhttp.SignedSnapshot {
+	return &registryhttp.SignedSnapshot{
+		Snapshot:  snapshot.Data,
+		Algorithm: registryhttp.SnapshotAlgorithm,
+		PublicKey: hex.EncodeToString(snapshot.PublicKey),
+		Signature: hex.EncodeToString(snapshot.Signature),
+	}
+}
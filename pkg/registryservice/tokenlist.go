@@ -0,0 +1,280 @@
+package registryservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	tokenListsCollection = "_tokenLists"
+	// tokenListAttempts defines how often publishing a token list version is retried if another request published
+	// one concurrently.
+	tokenListAttempts = 3
+)
+
+// ErrTokenListChanged is returned if the token list state was changed since it was loaded.
+var ErrTokenListChanged = errors.New("token list changed concurrently")
+
+// tokenListTags describes the tags used in the token lists.
+var tokenListTags = map[string]*registryhttp.TokenListTag{
+	registryhttp.TokenListTagAdmin:   {Name: "Admin", Description: "Registered by a registry admin."},
+	registryhttp.TokenListTagLegacy:  {Name: "Legacy", Description: "Registered before the registry recorded the provenance of tokens."},
+	registryhttp.TokenListTagFlagged: {Name: "Flagged", Description: "Reported and confirmed by a registry admin, e.g. as an impersonation or a scam."},
+}
+
+// LoadTokenListState loads the last published token list of a network, nil if none was published yet.
+func (s *Service) LoadTokenListState(ctx context.Context, network string) (state *registry.TokenListState, err error) {
+	// Query One
+	result := s.db.Collection(tokenListsCollection).FindOne(ctx, bson.M{"_id": network})
+	err = result.Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return
+}
+
+// SaveTokenListState publishes a token list version. It fails with ErrTokenListChanged unless previous is still the
+// published state, so concurrent requests can not bump the version twice.
+func (s *Service) SaveTokenListState(ctx context.Context, state *registry.TokenListState, previous *registry.TokenListState) error {
+	collection := s.db.Collection(tokenListsCollection)
+	if previous == nil {
+		_, err := collection.InsertOne(ctx, state)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrTokenListChanged
+		}
+		return errors.Wrap(err, "failed to insert token list into mongo collection")
+	}
+	filter := bson.M{"_id": previous.Network, "version": previous.Version}
+	result, err := collection.ReplaceOne(ctx, filter, state)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace token list in mongo collection")
+	}
+	if result.MatchedCount == 0 {
+		return ErrTokenListChanged
+	}
+	return nil
+}
+
+// LoadTokenList serves the tokens of a network as a token list, with the version the TokenListPublisher published
+// for them last.
+func (h *HTTPHandler) LoadTokenList(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !networkAllowed(network) {
+		return c.JSON(http.StatusForbidden, errorResponse(c, ErrNetworkNotAllowed))
+	}
+	tokens, err := h.service.LoadTokens(ctx, network)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load tokens")))
+	}
+	state, err := h.service.LoadTokenListState(ctx, network)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load token list")))
+	}
+	if state == nil {
+		// the first version is published once the publisher started
+		state = &registry.TokenListState{Version: registry.TokenListVersion{Major: 1}, Timestamp: time.Now().UTC()}
+	}
+
+	// registry logos are linked relative to the registry, which is left out of the digests
+	entries := tokenListEntries(network, tokens)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.LogoURI, "/") {
+			entry.LogoURI = h.publicURL + entry.LogoURI
+		}
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=60")
+	return c.JSON(http.StatusOK, &registryhttp.TokenList{
+		Name:      network + " token registry",
+		Timestamp: state.Timestamp,
+		Version:   state.Version,
+		Tokens:    entries,
+		Tags:      tokenListTags,
+	})
+}
+
+// TokenListPublisher publishes a new token list version of a network whenever its tokens changed: the major version
+// on removals, the minor version on additions and the patch version on metadata changes.
+type TokenListPublisher struct {
+	service registry.Service
+
+	pendingMutex sync.Mutex
+	pending      map[string]bool
+	wake         chan struct{}
+}
+
+func NewTokenListPublisher(service registry.Service) *TokenListPublisher {
+	return &TokenListPublisher{service: service, pending: make(map[string]bool), wake: make(chan struct{}, 1)}
+}
+
+// Enqueue queues the token list of the network of event to be published. It is registered with EventFeed.OnPublish.
+func (p *TokenListPublisher) Enqueue(ctx context.Context, event *registry.Event) {
+	p.pendingMutex.Lock()
+	p.pending[event.Network] = true
+	p.pendingMutex.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the token lists of the enabled networks on start, in case they changed while no instance was
+// running, and then the queued ones until ctx is cancelled.
+func (p *TokenListPublisher) Run(ctx context.Context) {
+	for _, network := range EnabledNetworks() {
+		p.publish(ctx, network)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		}
+		p.pendingMutex.Lock()
+		networks := p.pending
+		p.pending = make(map[string]bool)
+		p.pendingMutex.Unlock()
+		for network := range networks {
+			p.publish(ctx, network)
+		}
+	}
+}
+
+func (p *TokenListPublisher) publish(ctx context.Context, network string) {
+	tokens, err := p.service.LoadTokens(ctx, network)
+	if err == nil {
+		_, err = publishTokenList(ctx, p.service, network, tokenListEntries(network, tokens), time.Now().UTC())
+	}
+	if err != nil {
+		ContextLogger(ctx).Warnw("Failed to publish token list", "network", network, "error", err)
+	}
+}
+
+// tokenListEntries converts tokens to token list entries sorted by ID.
+func tokenListEntries(network string, tokens []*registry.IRC30Token) []*registryhttp.TokenListEntry {
+	entries := make([]*registryhttp.TokenListEntry, 0, len(tokens))
+	for _, token := range tokens {
+		entry := &registryhttp.TokenListEntry{
+			Network:  network,
+			Address:  token.ID,
+			Name:     token.Name,
+			Symbol:   token.Symbol,
+			Decimals: token.Decimals,
+		}
+		// same precedence as LoadLogo
+		switch {
+		case token.Logo != "":
+			entry.LogoURI = registryhttp.APIv2Endpoint + registryhttp.RegistriesEndpoint + "/" + url.PathEscape(network) +
+				registryhttp.TokensEndpoint + "/" + url.PathEscape(token.ID) + registryhttp.LogoEndpoint
+		case token.LogoHash != "":
+			entry.LogoURI = registryhttp.APIv2Endpoint + registryhttp.LogosEndpoint + "/" + token.LogoHash
+		default:
+			entry.LogoURI = token.LogoURL
+		}
+		switch {
+		case token.Provenance == nil:
+			entry.Tags = []string{registryhttp.TokenListTagLegacy}
+		case net.ParseIP(token.Provenance.RegisteredBy) == nil:
+			entry.Tags = []string{registryhttp.TokenListTagAdmin}
+		}
+		if token.Flag != nil {
+			entry.Tags = append(entry.Tags, registryhttp.TokenListTagFlagged)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Address < entries[j].Address })
+	return entries
+}
+
+// publishTokenList returns the token list state of entries, publishing a new version if they changed.
+func publishTokenList(ctx context.Context, service registry.Service, network string, entries []*registryhttp.TokenListEntry, now time.Time) (*registry.TokenListState, error) {
+	digests := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		digest, err := tokenListDigest(entry)
+		if err != nil {
+			return nil, err
+		}
+		digests[entry.Address] = digest
+	}
+
+	for attempt := 0; attempt < tokenListAttempts; attempt++ {
+		previous, err := service.LoadTokenListState(ctx, network)
+		if err != nil {
+			return nil, errors.Wrap(err, "service failed to load token list")
+		}
+		version, changed := nextTokenListVersion(previous, digests)
+		if !changed {
+			return previous, nil
+		}
+		state := &registry.TokenListState{Network: network, Version: version, Timestamp: now, Digests: digests}
+		err = service.SaveTokenListState(ctx, state, previous)
+		if err == nil {
+			return state, nil
+		}
+		if !errors.Is(err, ErrTokenListChanged) {
+			return nil, errors.Wrap(err, "service failed to save token list")
+		}
+	}
+	return nil, ErrTokenListChanged
+}
+
+// nextTokenListVersion returns the version of a token list with the given digests and whether it differs from
+// the previous one. The first version is 1.0.0.
+func nextTokenListVersion(previous *registry.TokenListState, digests map[string]string) (registry.TokenListVersion, bool) {
+	if previous == nil {
+		return registry.TokenListVersion{Major: 1}, true
+	}
+	var removed, added, changed bool
+	for ID, digest := range previous.Digests {
+		current, ok := digests[ID]
+		switch {
+		case !ok:
+			removed = true
+		case current != digest:
+			changed = true
+		}
+	}
+	for ID := range digests {
+		if _, ok := previous.Digests[ID]; !ok {
+			added = true
+		}
+	}
+
+	version := previous.Version
+	switch {
+	case removed:
+		version = registry.TokenListVersion{Major: version.Major + 1}
+	case added:
+		version = registry.TokenListVersion{Major: version.Major, Minor: version.Minor + 1}
+	case changed:
+		version.Patch++
+	default:
+		return version, false
+	}
+	return version, true
+}
+
+func tokenListDigest(entry *registryhttp.TokenListEntry) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode token list entry")
+	}
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
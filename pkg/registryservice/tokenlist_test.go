@@ -0,0 +1,107 @@
+package registryservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+// stubTokenLists holds the published token list state of a network, any call it does not implement panics. The first
+// conflicts saves fail as if another request published a version concurrently.
+type stubTokenLists struct {
+	registry.Service
+	state     *registry.TokenListState
+	conflicts int
+}
+
+func (s *stubTokenLists) LoadTokenListState(context.Context, string) (*registry.TokenListState, error) {
+	return s.state, nil
+}
+
+func (s *stubTokenLists) SaveTokenListState(_ context.Context, state *registry.TokenListState, previous *registry.TokenListState) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		// the concurrent request published a patch version
+		concurrent := *s.state
+		concurrent.Version.Patch++
+		s.state = &concurrent
+		return ErrTokenListChanged
+	}
+	if previous != s.state {
+		return ErrTokenListChanged
+	}
+	s.state = state
+	return nil
+}
+
+func TestNextTokenListVersion(t *testing.T) {
+	previous := &registry.TokenListState{
+		Version: registry.TokenListVersion{Major: 2, Minor: 3, Patch: 4},
+		Digests: map[string]string{"0x01": "a", "0x02": "b"},
+	}
+	tests := []struct {
+		name        string
+		previous    *registry.TokenListState
+		digests     map[string]string
+		want        registry.TokenListVersion
+		wantChanged bool
+	}{
+		{name: "first", digests: map[string]string{"0x01": "a"}, want: registry.TokenListVersion{Major: 1}, wantChanged: true},
+		{name: "unchanged", previous: previous, digests: map[string]string{"0x01": "a", "0x02": "b"}, want: registry.TokenListVersion{Major: 2, Minor: 3, Patch: 4}},
+		{name: "metadata changed", previous: previous, digests: map[string]string{"0x01": "a", "0x02": "c"}, want: registry.TokenListVersion{Major: 2, Minor: 3, Patch: 5}, wantChanged: true},
+		{name: "added", previous: previous, digests: map[string]string{"0x01": "a", "0x02": "b", "0x03": "c"}, want: registry.TokenListVersion{Major: 2, Minor: 4}, wantChanged: true},
+		{name: "added and changed", previous: previous, digests: map[string]string{"0x01": "a", "0x02": "c", "0x03": "c"}, want: registry.TokenListVersion{Major: 2, Minor: 4}, wantChanged: true},
+		{name: "removed", previous: previous, digests: map[string]string{"0x01": "a"}, want: registry.TokenListVersion{Major: 3}, wantChanged: true},
+		{name: "removed and added", previous: previous, digests: map[string]string{"0x01": "a", "0x03": "c"}, want: registry.TokenListVersion{Major: 3}, wantChanged: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, changed := nextTokenListVersion(test.previous, test.digests)
+			if got != test.want || changed != test.wantChanged {
+				t.Errorf("nextTokenListVersion() = %s, %v, want %s, %v", got, changed, test.want, test.wantChanged)
+			}
+		})
+	}
+}
+
+func TestPublishTokenList(t *testing.T) {
+	entries := []*registryhttp.TokenListEntry{{Network: "alphanet", Address: "0x01", Name: "One", Symbol: "ONE"}}
+	published := &registry.TokenListState{Network: "alphanet", Version: registry.TokenListVersion{Major: 1}, Digests: map[string]string{}}
+	tests := []struct {
+		name      string
+		state     *registry.TokenListState
+		conflicts int
+		want      registry.TokenListVersion
+		wantErr   bool
+	}{
+		{name: "first version", want: registry.TokenListVersion{Major: 1}},
+		{name: "token added", state: published, want: registry.TokenListVersion{Major: 1, Minor: 1}},
+		{name: "published concurrently", state: published, conflicts: 1, want: registry.TokenListVersion{Major: 1, Minor: 1}},
+		{name: "keeps conflicting", state: published, conflicts: tokenListAttempts, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &stubTokenLists{state: test.state, conflicts: test.conflicts}
+			state, err := publishTokenList(context.Background(), service, "alphanet", entries, time.Now())
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("publishTokenList() = %s, want error", state.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("publishTokenList() error = %v", err)
+			}
+			if state.Version != test.want || service.state != state {
+				t.Errorf("publishTokenList() published %s, want %s", state.Version, test.want)
+			}
+			again, err := publishTokenList(context.Background(), service, "alphanet", entries, time.Now())
+			if err != nil || again != state {
+				t.Errorf("publishing unchanged entries returned %v, %v, want the published state", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package registryservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+	iotago "github.com/iotaledger/iota.go/v3"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	verifiedIssuersCollection = "_verifiedIssuers"
+
+	// maxIssuerNameLength defines the maximum length of the name of a verified issuer in characters.
+	maxIssuerNameLength = 64
+)
+
+func (s *Service) SetTrustLevel(ctx context.Context, network string, ID string, level string) error {
+	update := bson.M{"$set": bson.M{"trustLevel": level}}
+	if level == "" {
+		update = bson.M{"$unset": bson.M{"trustLevel": ""}}
+	}
+	result, err := s.db.Collection(network).UpdateOne(ctx, bson.M{"ID": ID}, update)
+	if err != nil {
+		return errors.Wrap(err, "failed to update trust level in mongo collection")
+	}
+	if result.MatchedCount == 0 {
+		return errors.Newf("token %s not found", ID)
+	}
+	return nil
+}
+
+func (s *Service) SaveVerifiedIssuer(ctx context.Context, issuer *registry.VerifiedIssuer) error {
+	issuer.ID = issuer.Network + "/" + issuer.AliasID
+	_, err := s.db.Collection(verifiedIssuersCollection).ReplaceOne(ctx, bson.M{"_id": issuer.ID}, issuer, options.Replace().SetUpsert(true))
+	return errors.Wrap(err, "failed to save verified issuer into mongo collection")
+}
+
+func (s *Service) LoadVerifiedIssuers(ctx context.Context, network string) (issuers []*registry.VerifiedIssuer, err error) {
+	issuers = make([]*registry.VerifiedIssuer, 0)
+	cur, err := s.db.Collection(verifiedIssuersCollection).Find(ctx, bson.M{"network": network}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &issuers)
+	return
+}
+
+func (s *Service) DeleteVerifiedIssuer(ctx context.Context, network string, aliasID string) error {
+	result, err := s.db.Collection(verifiedIssuersCollection).DeleteOne(ctx, bson.M{"_id": network + "/" + aliasID})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete verified issuer from mongo collection")
+	}
+	if result.DeletedCount == 0 {
+		return errors.Newf("issuer %s is not verified", aliasID)
+	}
+	return nil
+}
+
+// trustLevel returns the trust level of a token. The level an admin assigned replaces the derived one, which is
+// ledger-verified if the last verification of the token matched the ledger, and issuer-signed if its issuer alias is
+// verified as well. Tokens the registry did not verify, e.g. those imported without verification, are unverified. A
+// token that no longer matches the ledger is unverified whatever it was assigned.
+func trustLevel(token *registry.IRC30Token, issuer *registry.VerifiedIssuer) string {
+	status := verificationStatus(token)
+	switch {
+	case status == registryhttp.VerificationMismatch:
+		return registryhttp.TrustUnverified
+	case token.TrustLevel != "":
+		return token.TrustLevel
+	case status != registryhttp.VerificationVerified:
+		return registryhttp.TrustUnverified
+	case issuer != nil:
+		return registryhttp.TrustIssuerSigned
+	default:
+		return registryhttp.TrustLedgerVerified
+	}
+}
+
+// tokenIssuer returns the verified issuer of a token, nil if its issuer alias is not verified.
+func tokenIssuer(token *registry.IRC30Token, issuers map[string]*registry.VerifiedIssuer) *registry.VerifiedIssuer {
+	alias := issuerAlias("", token.ID)
+	if alias == nil {
+		return nil
+	}
+	return issuers[alias.AliasID]
+}
+
+// verifiedIssuers loads the verified issuers of a network by alias ID.
+func (h *HTTPHandler) verifiedIssuers(ctx context.Context, network string) (map[string]*registry.VerifiedIssuer, error) {
+	issuers, err := h.service.LoadVerifiedIssuers(ctx, network)
+	if err != nil {
+		return nil, errors.Wrap(err, "service failed to load verified issuers")
+	}
+	result := make(map[string]*registry.VerifiedIssuer, len(issuers))
+	for _, issuer := range issuers {
+		result[issuer.AliasID] = issuer
+	}
+	return result, nil
+}
+
+// SetTrustLevel assigns a trust level to a token, an empty level derives it from the checks again.
+func (h *HTTPHandler) SetTrustLevel(c echo.Context) error {
+	ctx := c.Request().Context()
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	var req *registryhttp.SetTrustLevelRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil || req == nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("failed to parse request body as JSON into a trust level")))
+	}
+	if req.TrustLevel != "" && registryhttp.TrustRank(req.TrustLevel) < 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid trust level %q, must be one of %s", req.TrustLevel, strings.Join(registryhttp.TrustLevels, ", "))))
+	}
+	ID := c.Param("ID")
+	if err := h.service.SetTrustLevel(ctx, network, ID, req.TrustLevel); err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to set trust level")))
+	}
+	h.auditor.Record(c, "setTrustLevel", network, ID+" "+req.TrustLevel)
+	return c.JSON(http.StatusOK, req)
+}
+
+func (h *HTTPHandler) LoadVerifiedIssuers(c echo.Context) error {
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	issuers, err := h.service.LoadVerifiedIssuers(c.Request().Context(), network)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load verified issuers")))
+	}
+	return c.JSON(http.StatusOK, issuers)
+}
+
+// VerifyIssuer marks an issuer alias as verified, its ledger-verified tokens inherit the badge and the issuer-signed
+// trust level. Verifying a verified alias again updates its name and note.
+func (h *HTTPHandler) VerifyIssuer(c echo.Context) error {
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	aliasID, err := parseAliasID(c.Param("aliasID"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	var req *registryhttp.VerifyIssuerRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil || req == nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.New("failed to parse request body as JSON into an issuer")))
+	}
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxIssuerNameLength {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("issuer name must have 1 to %d characters", maxIssuerNameLength)))
+	}
+	if utf8.RuneCountInString(req.Note) > maxNoteLength {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("note must not exceed %d characters", maxNoteLength)))
+	}
+	issuer := &registry.VerifiedIssuer{
+		Network:    network,
+		AliasID:    aliasID,
+		Name:       req.Name,
+		Note:       req.Note,
+		VerifiedAt: time.Now().UTC(),
+		VerifiedBy: AdminIdentity(c).String(),
+	}
+	if err := h.service.SaveVerifiedIssuer(c.Request().Context(), issuer); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save verified issuer")))
+	}
+	h.auditor.Record(c, "verifyIssuer", network, aliasID)
+	return c.JSON(http.StatusOK, issuer)
+}
+
+func (h *HTTPHandler) UnverifyIssuer(c echo.Context) error {
+	network := c.Param("network")
+	if !validNetworkName(network) {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, ErrInvalidNetworkName))
+	}
+	aliasID, err := parseAliasID(c.Param("aliasID"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	if err := h.service.DeleteVerifiedIssuer(c.Request().Context(), network, aliasID); err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to delete verified issuer")))
+	}
+	h.auditor.Record(c, "unverifyIssuer", network, aliasID)
+	return c.JSON(http.StatusOK, nil)
+}
+
+// parseAliasID parses a hex encoded alias ID into the form issuerAlias derives from token IDs.
+func parseAliasID(aliasID string) (string, error) {
+	aliasIDBytes, err := iotago.DecodeHex(strings.ToLower(aliasID))
+	if err != nil || len(aliasIDBytes) != iotago.AliasIDLength {
+		return "", errors.Newf("invalid alias ID %q, must be %d hex encoded bytes with 0x prefix", aliasID, iotago.AliasIDLength)
+	}
+	return iotago.EncodeHex(aliasIDBytes), nil
+}
@@ -0,0 +1,96 @@
+package registryservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func TestTrustLevel(t *testing.T) {
+	verifiedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	issuer := &registry.VerifiedIssuer{Name: "Acme"}
+	tests := []struct {
+		name   string
+		token  *registry.IRC30Token
+		issuer *registry.VerifiedIssuer
+		want   string
+	}{
+		{name: "registered", token: &registry.IRC30Token{VerifiedAt: verifiedAt}, want: registryhttp.TrustLedgerVerified},
+		{name: "registered before API v2", token: &registry.IRC30Token{}, want: registryhttp.TrustLedgerVerified},
+		{name: "verified again", token: &registry.IRC30Token{VerifiedAt: verifiedAt, VerificationStatus: registryhttp.VerificationVerified}, want: registryhttp.TrustLedgerVerified},
+		{name: "imported without verification", token: &registry.IRC30Token{VerificationStatus: registryhttp.VerificationUnverified}, want: registryhttp.TrustUnverified},
+		{name: "unavailable", token: &registry.IRC30Token{VerifiedAt: verifiedAt, VerificationStatus: registryhttp.VerificationUnavailable}, want: registryhttp.TrustUnverified},
+		{name: "mismatch", token: &registry.IRC30Token{VerifiedAt: verifiedAt, VerificationStatus: registryhttp.VerificationMismatch}, want: registryhttp.TrustUnverified},
+		{name: "verified issuer", token: &registry.IRC30Token{VerifiedAt: verifiedAt}, issuer: issuer, want: registryhttp.TrustIssuerSigned},
+		{name: "verified issuer of an unverified token", token: &registry.IRC30Token{VerificationStatus: registryhttp.VerificationUnverified}, issuer: issuer, want: registryhttp.TrustUnverified},
+		{name: "assigned", token: &registry.IRC30Token{TrustLevel: registryhttp.TrustTeamVetted}, want: registryhttp.TrustTeamVetted},
+		{name: "assigned to a mismatch", token: &registry.IRC30Token{VerifiedAt: verifiedAt, VerificationStatus: registryhttp.VerificationMismatch, TrustLevel: registryhttp.TrustTeamVetted}, want: registryhttp.TrustUnverified},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := trustLevel(test.token, test.issuer); got != test.want {
+				t.Errorf("trustLevel() = %s, want %s", got, test.want)
+			}
+			// the v2 representation must not contradict a derived trust level
+			status := tokenV2("rms", test.token, test.issuer).Verification.Status
+			if test.token.TrustLevel == "" && (status == registryhttp.VerificationVerified) != (test.want != registryhttp.TrustUnverified) {
+				t.Errorf("tokenV2() has verification status %s with trust level %s", status, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanImportVerification(t *testing.T) {
+	verifiedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		record *registryhttp.TokenRecord
+	}{
+		{name: "verified record", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { r.VerifiedAt = &verifiedAt })},
+		{name: "record without verification", record: testRecord("0x01", "One", nil)},
+		{name: "record with status", record: testRecord("0x01", "One", func(r *registryhttp.TokenRecord) {
+			r.VerificationStatus = registryhttp.VerificationVerified
+		})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &HTTPHandler{service: &stubTokens{}, filter: NewSwearFilter()}
+			record, _, err := h.planImport(importContext(), "alphanet", testLine(t, test.record), registryhttp.ImportConflictFail, false, make(map[string]int))
+			if err != nil {
+				t.Fatalf("planImport() error = %v", err)
+			}
+			token := *record.IRC30Token
+			token.VerifiedAt = timeValue(record.VerifiedAt)
+			token.VerificationStatus = record.VerificationStatus
+			if got := trustLevel(&token, nil); got != registryhttp.TrustUnverified {
+				t.Errorf("trust level of a token imported without verification = %s, want %s", got, registryhttp.TrustUnverified)
+			}
+		})
+	}
+}
+
+func TestPlanImportTrustLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr bool
+	}{
+		{name: "trust admin", scopes: []string{ScopeTokensImport, ScopeTrustAdmin}},
+		{name: "all scopes", scopes: []string{ScopeAll}},
+		{name: "import only", scopes: []string{ScopeTokensImport}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := importContext()
+			c.Set(identityContextKey, &Identity{Admin: "alice", Scopes: test.scopes})
+			record := testRecord("0x01", "One", func(r *registryhttp.TokenRecord) { r.TrustLevel = registryhttp.TrustTeamVetted })
+			h := &HTTPHandler{service: &stubTokens{}, filter: NewSwearFilter()}
+			_, _, err := h.planImport(c, "alphanet", testLine(t, record), registryhttp.ImportConflictFail, false, make(map[string]int))
+			if (err != nil) != test.wantErr {
+				t.Errorf("planImport() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package registryservice
+
+import (
+	"context"
+
+	"github.com/capossele/swearfilter"
+	"github.com/cockroachdb/errors"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+const (
+	// maxNameLength defines the maximum length of a token name.
+	maxNameLength = 20
+	// maxSymbolLength defines the maximum length of a token symbol.
+	maxSymbolLength = 4
+)
+
+// Check is a single named check a token has to pass to be registered.
+type Check struct {
+	// Name identifies the check in validation results.
+	Name string
+	// Kind groups checks by the reason a registration is rejected for in metrics.
+	Kind string
+	// Run performs the check and returns why it failed, if so.
+	Run func(ctx context.Context) error
+}
+
+// NewSwearFilter creates a swear filter preloaded with the default bad words.
+func NewSwearFilter() *swearfilter.SwearFilter {
+	return swearfilter.NewSwearFilter(true, badWords...)
+}
+
+// StaticChecks returns the checks that need neither the registry nor the ledger:
+// 1. Perform token name length check
+// 2. Perform token symbol length check
+// 3. Perform swear check on name, ID, symbol and description
+// 4. Perform logo format, size and dimension check
+func StaticChecks(filter *swearfilter.SwearFilter, token *registry.IRC30Token) []Check {
+	return []Check{
+		{Name: "nameLength", Kind: ReasonValidation, Run: func(context.Context) error {
+			if len(token.Name) > maxNameLength {
+				return errors.New("IRC30Token name too long")
+			}
+			return nil
+		}},
+		{Name: "symbolLength", Kind: ReasonValidation, Run: func(context.Context) error {
+			if len(token.Symbol) > maxSymbolLength {
+				return errors.New("IRC30Token symbol too long")
+			}
+			return nil
+		}},
+		filterCheck("nameFilter", filter, token.Name),
+		filterCheck("IDFilter", filter, token.ID),
+		filterCheck("symbolFilter", filter, token.Symbol),
+		filterCheck("descriptionFilter", filter, token.Description),
+		{Name: "logo", Kind: ReasonLogo, Run: func(context.Context) error {
+			_, err := NormalizeLogo(token.Logo)
+			return err
+		}},
+	}
+}
+
+func filterCheck(name string, filter *swearfilter.SwearFilter, field string) Check {
+	return Check{Name: name, Kind: ReasonFilter, Run: func(context.Context) error {
+		match, _ := filter.Check(field)
+		if len(match) > 0 {
+			return errors.Newf("%s is forbidden, as contains %v", field, match)
+		}
+		return nil
+	}}
+}
+
+// UniquenessChecks returns the checks that the token name, symbol and ID are not yet taken in the registry.
+func UniquenessChecks(service registry.Service, network string, token *registry.IRC30Token) []Check {
+	return append(uniqueNameChecks(service, network, token), Check{Name: "uniqueID", Kind: ReasonUniqueness, Run: func(ctx context.Context) error {
+		if _, err := service.LoadToken(ctx, network, token.ID); err == nil {
+			return errors.New("token ID already registered")
+		}
+		return nil
+	}})
+}
+
+// uniqueNameChecks returns the checks that the token name and symbol are not taken by another token, the token
+// registered under the same ID may hold them already.
+func uniqueNameChecks(service registry.Service, network string, token *registry.IRC30Token) []Check {
+	return []Check{
+		{Name: "uniqueName", Kind: ReasonUniqueness, Run: func(ctx context.Context) error {
+			if found, err := service.FindTokenByName(ctx, network, token.Name); err == nil && found.ID != token.ID {
+				return errors.New("token name already taken")
+			}
+			return nil
+		}},
+		{Name: "uniqueSymbol", Kind: ReasonUniqueness, Run: func(ctx context.Context) error {
+			if found, err := service.FindTokenBySymbol(ctx, network, token.Symbol); err == nil && found.ID != token.ID {
+				return errors.New("token symbol already taken")
+			}
+			return nil
+		}},
+	}
+}
+
+// VerificationCheck returns the check that the token exists on the ledger and its maxSupply matches the foundry.
+func VerificationCheck(verifier *Verifier, network string, token *registry.IRC30Token) Check {
+	return Check{Name: "ledgerVerification", Kind: ReasonVerification, Run: func(ctx context.Context) error {
+		if _, err := verifier.Verify(ctx, network, token); err != nil {
+			return errors.Wrap(err, "token verification failed")
+		}
+		return nil
+	}}
+}
+
+// LogoFetchCheck returns the check that the logo at LogoURL can be fetched and passes the logo checks.
+func LogoFetchCheck(fetcher *LogoFetcher, token *registry.IRC30Token) Check {
+	return Check{Name: "logoURLFetch", Kind: ReasonLogo, Run: func(ctx context.Context) error {
+		if _, err := fetcher.Fetch(ctx, token.LogoURL); err != nil {
+			return errors.Wrap(err, "failed to pin logo from logoURL")
+		}
+		return nil
+	}}
+}
+
+// RunChecks runs all checks and reports the outcome of each of them.
+func RunChecks(ctx context.Context, checks []Check) (results []*registryhttp.CheckResult, valid bool) {
+	valid = true
+	results = make([]*registryhttp.CheckResult, 0, len(checks))
+	for _, check := range checks {
+		result := &registryhttp.CheckResult{Check: check.Name, Passed: true}
+		if err := check.Run(ctx); err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+			valid = false
+		}
+		results = append(results, result)
+	}
+	return
+}
+
+// firstFailure runs the checks in order and returns the kind and error of the first one that fails.
+func firstFailure(ctx context.Context, checks []Check) (kind string, err error) {
+	for _, check := range checks {
+		if err = check.Run(ctx); err != nil {
+			return check.Kind, err
+		}
+	}
+	return "", nil
+}
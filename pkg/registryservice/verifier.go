@@ -7,51 +7,112 @@ import (
 	"github.com/lzpap/token-verifier/pkg/registry"
 	"github.com/pkg/errors"
 	"net/url"
+	"sync"
 	"time"
 )
 
+// LedgerFoundry defines a foundry output as read from the ledger.
+type LedgerFoundry struct {
+	OutputID iotago.OutputID
+	Output   *iotago.FoundryOutput
+	// LedgerIndex defines the milestone index of the ledger the output was read at.
+	LedgerIndex uint32
+}
+
 type Verifier struct {
 	client *nodeclient.Client
+
+	// bech32HRPs caches the address prefixes of the networks, which do not change.
+	bech32HRPsMutex sync.RWMutex
+	bech32HRPs      map[string]iotago.NetworkPrefix
 }
 
 // NewVerifier creates a new token verifier.
 func NewVerifier(baseUrl string) *Verifier {
 	return &Verifier{
-		client: nodeclient.New(baseUrl),
+		client:     nodeclient.New(baseUrl),
+		bech32HRPs: make(map[string]iotago.NetworkPrefix),
+	}
+}
+
+// Bech32HRP returns the prefix of the bech32 addresses of network.
+func (v *Verifier) Bech32HRP(ctx context.Context, network string) (iotago.NetworkPrefix, error) {
+	v.bech32HRPsMutex.RLock()
+	hrp, ok := v.bech32HRPs[network]
+	v.bech32HRPsMutex.RUnlock()
+	if ok {
+		return hrp, nil
+	}
+
+	start := time.Now()
+	info, err := v.client.Info(ctx)
+	observeNodeRequest(network, "info", start, err)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get node info")
+	}
+	v.bech32HRPsMutex.Lock()
+	defer v.bech32HRPsMutex.Unlock()
+	v.bech32HRPs[network] = info.Protocol.Bech32HRP
+	return info.Protocol.Bech32HRP, nil
+}
+
+// NodeStatus returns the status of the node used to verify the tokens of network and fails if it is not synced.
+func (v *Verifier) NodeStatus(ctx context.Context, network string) (*nodeclient.InfoResStatus, error) {
+	start := time.Now()
+	info, err := v.client.Info(ctx)
+	observeNodeRequest(network, "info", start, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get node info")
+	}
+	if !info.Status.IsHealthy {
+		return &info.Status, errors.New("node is not synced")
 	}
+	return &info.Status, nil
 }
 
-func (v *Verifier) Verify(token *registry.IRC30Token) error {
+// Node returns the url of the node without credentials.
+func (v *Verifier) Node() string {
+	u, err := url.Parse(v.client.BaseURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
+
+// Verify checks that the token is a valid simple token scheme foundry on the ledger of network and returns the
+// foundry it was verified against.
+func (v *Verifier) Verify(ctx context.Context, network string, token *registry.IRC30Token) (*LedgerFoundry, error) {
 	// Can it be parsed to bytes
 	tokenIdBytes, err := iotago.DecodeHex(token.ID)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse tokenId")
+		return nil, errors.Wrap(err, "failed to parse tokenId")
 	}
 	// is it the correct length?
 	if len(tokenIdBytes) != iotago.FoundryIDLength {
-		return errors.New("tokenId is not valid, wrong length")
+		return nil, errors.New("tokenId is not valid, wrong length")
 	}
 	// the first byte is always an alias address type byte
 	if tokenIdBytes[0] != byte(iotago.AddressAlias) {
-		return errors.New("tokenId does not start with an alias address type byte")
+		return nil, errors.New("tokenId does not start with an alias address type byte")
 	}
 	// tokenScheme is simple, meaning the last byt us 0
 	if tokenIdBytes[iotago.FoundryIDLength-1] != 0 {
-		return errors.New("tokenId does not end with a 0 byte")
+		return nil, errors.New("tokenId does not end with a 0 byte")
 	}
 
 	var foundryId iotago.FoundryID
 	copy(foundryId[:], tokenIdBytes)
 
 	if token.Decimals == 0 {
-		return errors.New("tokenDecimals is 0")
+		return nil, errors.New("tokenDecimals is 0")
 	}
 
 	// validate token url if present
 	if len(token.URL) > 0 {
 		_, err = url.ParseRequestURI(token.URL)
 		if err != nil {
-			return errors.Wrap(err, "failed to validate tokenURL")
+			return nil, errors.Wrap(err, "failed to validate tokenURL")
 		}
 	}
 
@@ -59,31 +120,72 @@ func (v *Verifier) Verify(token *registry.IRC30Token) error {
 	if len(token.LogoURL) > 0 {
 		_, err = url.ParseRequestURI(token.LogoURL)
 		if err != nil {
-			return errors.Wrap(err, "failed to validate logoURL")
+			return nil, errors.Wrap(err, "failed to validate logoURL")
 		}
 	}
 
-	// fetch the foundry output
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	foundry, err := v.foundry(ctx, network, foundryId)
+	if err != nil {
+		return nil, err
+	}
+
+	supplyInfo, err := SimpleTokenScheme(foundry.Output)
+	if err != nil {
+		return nil, err
+	}
+	if supplyInfo.MaximumSupply.String() != token.MaxSupply {
+		return nil, errors.New("mismatch in maximum supply")
+	}
+
+	return foundry, nil
+}
+
+// Foundry returns the current foundry output of the token ID from the ledger of network.
+func (v *Verifier) Foundry(ctx context.Context, network string, ID string) (*LedgerFoundry, error) {
+	tokenIdBytes, err := iotago.DecodeHex(ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse tokenId")
+	}
+	if len(tokenIdBytes) != iotago.FoundryIDLength {
+		return nil, errors.New("tokenId is not valid, wrong length")
+	}
+	var foundryId iotago.FoundryID
+	copy(foundryId[:], tokenIdBytes)
+	return v.foundry(ctx, network, foundryId)
+}
+
+func (v *Verifier) foundry(ctx context.Context, network string, foundryId iotago.FoundryID) (*LedgerFoundry, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*15)
 	defer cancel()
 
+	start := time.Now()
 	indexerClient, err := v.client.Indexer(ctx)
+	observeNodeRequest(network, "indexer", start, err)
 	if err != nil {
-		return errors.Wrap(err, "failed to get indexer client")
+		return nil, errors.Wrap(err, "failed to get indexer client")
 	}
 
-	_, fOutput, err := indexerClient.Foundry(ctx, foundryId)
+	start = time.Now()
+	outputID, fOutput, err := indexerClient.Foundry(ctx, foundryId)
+	observeNodeRequest(network, "foundry", start, err)
 	if err != nil {
-		return errors.Wrap(err, "failed to get foundry output")
+		return nil, errors.Wrap(err, "failed to get foundry output")
 	}
 
-	supplyInfo, ok := fOutput.TokenScheme.(*iotago.SimpleTokenScheme)
-	if !ok {
-		return errors.New("foundry output is not a simple token scheme")
-	}
-	if supplyInfo.MaximumSupply.String() != token.MaxSupply {
-		return errors.New("mismatch in maximum supply")
+	start = time.Now()
+	metadata, err := v.client.OutputMetadataByID(ctx, *outputID)
+	observeNodeRequest(network, "outputMetadata", start, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get foundry output metadata")
 	}
+	return &LedgerFoundry{OutputID: *outputID, Output: fOutput, LedgerIndex: metadata.LedgerIndex}, nil
+}
 
-	return nil
+// SimpleTokenScheme returns the supply information of a foundry, which must use the simple token scheme.
+func SimpleTokenScheme(foundry *iotago.FoundryOutput) (*iotago.SimpleTokenScheme, error) {
+	scheme, ok := foundry.TokenScheme.(*iotago.SimpleTokenScheme)
+	if !ok {
+		return nil, errors.New("foundry output is not a simple token scheme")
+	}
+	return scheme, nil
 }
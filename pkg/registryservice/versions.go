@@ -0,0 +1,175 @@
+package registryservice
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	iotago "github.com/iotaledger/iota.go/v3"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+const (
+	APIv1 = 1
+	APIv2 = 2
+
+	apiVersionContextKey = "apiVersion"
+)
+
+// APIVersion selects the representation the shared handlers respond with. API v1 responses are marked deprecated
+// and link to their v2 successor.
+func APIVersion(version int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(apiVersionContextKey, version)
+			if version == APIv1 {
+				path := strings.TrimPrefix(c.Request().URL.Path, registryhttp.APIv1Endpoint)
+				header := c.Response().Header()
+				header.Set("Deprecation", "true")
+				header.Set("Link", "<"+registryhttp.APIv2Endpoint+path+`>; rel="successor-version"`)
+			}
+			return next(c)
+		}
+	}
+}
+
+// requestedAPIVersion returns the API version of the request, v1 for the unversioned routes.
+func requestedAPIVersion(c echo.Context) int {
+	if version, ok := c.Get(apiVersionContextKey).(int); ok {
+		return version
+	}
+	return APIv1
+}
+
+// respondTokens responds with the tokens in the representation of the requested API version, issuers holds the
+// verified issuers of the network by alias ID.
+func (h *HTTPHandler) respondTokens(c echo.Context, status int, network string, tokens []*registry.IRC30Token, issuers map[string]*registry.VerifiedIssuer) error {
+	if requestedAPIVersion(c) == APIv1 {
+		return c.JSON(status, tokens)
+	}
+	hrp := h.bech32HRP(c.Request().Context(), network)
+	result := make([]*registryhttp.TokenV2, len(tokens))
+	for i, token := range tokens {
+		result[i] = tokenV2(hrp, token, tokenIssuer(token, issuers))
+	}
+	return c.JSON(status, result)
+}
+
+// respondToken responds with the token in the representation of the requested API version. With live set, the v2
+// representation reports the current supply.
+func (h *HTTPHandler) respondToken(c echo.Context, status int, network string, token *registry.IRC30Token, live bool) error {
+	if requestedAPIVersion(c) == APIv1 {
+		return c.JSON(status, token)
+	}
+	ctx := c.Request().Context()
+	issuers, err := h.verifiedIssuers(ctx, network)
+	if err != nil {
+		ContextLogger(ctx).Warnw("Failed to load verified issuers", "network", network, "error", err)
+	}
+	result := tokenV2(h.bech32HRP(ctx, network), token, tokenIssuer(token, issuers))
+	if live {
+		h.addSupply(ctx, network, result)
+	}
+	return c.JSON(status, result)
+}
+
+// bech32HRP returns the address prefix of network, empty if the node can not be reached.
+func (h *HTTPHandler) bech32HRP(ctx context.Context, network string) iotago.NetworkPrefix {
+	hrp, err := h.verifier.Bech32HRP(ctx, network)
+	if err != nil {
+		ContextLogger(ctx).Debugw("Failed to resolve the bech32 prefix", "network", network, "error", err)
+	}
+	return hrp
+}
+
+// addSupply adds the current supply of the foundry to the token. The supply is left out if the node can not be
+// reached, the stored verification status is served either way.
+func (h *HTTPHandler) addSupply(ctx context.Context, network string, token *registryhttp.TokenV2) {
+	foundry, err := h.verifier.Foundry(ctx, network, token.ID)
+	var scheme *iotago.SimpleTokenScheme
+	if err == nil {
+		scheme, err = SimpleTokenScheme(foundry.Output)
+	}
+	if err != nil {
+		ContextLogger(ctx).Debugw("Failed to load the supply", "network", network, "token", token.ID, "error", err)
+		return
+	}
+	token.Supply = &registryhttp.TokenSupply{
+		MaximumSupply:     scheme.MaximumSupply.String(),
+		MintedTokens:      scheme.MintedTokens.String(),
+		MeltedTokens:      scheme.MeltedTokens.String(),
+		CirculatingSupply: new(big.Int).Sub(scheme.MintedTokens, scheme.MeltedTokens).String(),
+	}
+}
+
+// verificationStatus returns the outcome of the last verification of a token against the ledger. Tokens without
+// status matched the ledger ever since they were registered, those registered before API v2 lack the time.
+func verificationStatus(token *registry.IRC30Token) string {
+	if token.VerificationStatus == "" {
+		return registryhttp.VerificationVerified
+	}
+	return token.VerificationStatus
+}
+
+// tokenV2 returns the v2 representation of a token, issuer is its verified issuer or nil.
+func tokenV2(hrp iotago.NetworkPrefix, token *registry.IRC30Token, issuer *registry.VerifiedIssuer) *registryhttp.TokenV2 {
+	alias := issuerAlias(hrp, token.ID)
+	if alias != nil && issuer != nil {
+		alias.Verified = true
+		alias.Name = issuer.Name
+	}
+	return &registryhttp.TokenV2{
+		IRC30Token:   token,
+		IssuerAlias:  alias,
+		TrustLevel:   trustLevel(token, issuer),
+		Verification: &registryhttp.Verification{Status: verificationStatus(token), VerifiedAt: optionalTime(token.VerifiedAt)},
+		CreatedAt:    optionalTime(token.CreatedAt),
+		UpdatedAt:    optionalTime(token.UpdatedAt),
+		Provenance:   publicProvenance(token.Provenance),
+		Flag:         token.Flag,
+	}
+}
+
+// publicProvenance returns the provenance with the IP of the registering client reduced to its network, the full
+// address is kept for the admins only.
+func publicProvenance(provenance *registry.Provenance) *registry.Provenance {
+	if provenance == nil {
+		return nil
+	}
+	result := *provenance
+	if ip := net.ParseIP(result.RegisteredBy); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			result.RegisteredBy = ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+		} else {
+			result.RegisteredBy = ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+		}
+	}
+	return &result
+}
+
+// issuerAlias derives the alias controlling the foundry from the token ID, which starts with the alias address.
+// The bech32 address is left out if hrp is empty.
+func issuerAlias(hrp iotago.NetworkPrefix, ID string) *registryhttp.IssuerAlias {
+	tokenIdBytes, err := iotago.DecodeHex(ID)
+	if err != nil || len(tokenIdBytes) != iotago.FoundryIDLength || tokenIdBytes[0] != byte(iotago.AddressAlias) {
+		return nil
+	}
+	var alias iotago.AliasAddress
+	copy(alias[:], tokenIdBytes[1:iotago.AliasAddressSerializedBytesSize])
+	result := &registryhttp.IssuerAlias{AliasID: iotago.EncodeHex(alias[:])}
+	if hrp != "" {
+		result.Address = alias.Bech32(hrp)
+	}
+	return result
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,135 @@
+package registryservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubToken holds a single token, any call it does not implement panics.
+type stubToken struct {
+	registry.Service
+	token *registry.IRC30Token
+}
+
+func (s *stubToken) LoadToken(_ context.Context, _ string, ID string) (*registry.IRC30Token, error) {
+	if ID != s.token.ID {
+		return nil, mongo.ErrNoDocuments
+	}
+	found := *s.token
+	return &found, nil
+}
+
+func (s *stubToken) LoadVerifiedIssuers(context.Context, string) ([]*registry.VerifiedIssuer, error) {
+	return nil, nil
+}
+
+func TestLoadTokenVersions(t *testing.T) {
+	// the node is down, so the v2 representation lacks the bech32 address and the supply
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer node.Close()
+	ID := "0x08" + strings.Repeat("11", 32) + "0100000000"
+	h := &HTTPHandler{service: &stubToken{token: &registry.IRC30Token{ID: ID, Name: "One", Symbol: "ONE"}}, verifier: NewVerifier(node.URL)}
+
+	e := echo.New()
+	e.GET("/registries/:network/tokens/:ID", h.LoadToken, APIVersion(APIv1))
+	e.GET(registryhttp.APIv1Endpoint+"/registries/:network/tokens/:ID", h.LoadToken, APIVersion(APIv1))
+	e.GET(registryhttp.APIv2Endpoint+"/registries/:network/tokens/:ID", h.LoadToken, APIVersion(APIv2))
+
+	tests := []struct {
+		name     string
+		path     string
+		wantLink string
+		wantV2   bool
+	}{
+		{name: "unversioned", path: "/registries/alphanet/tokens/" + ID, wantLink: "<" + registryhttp.APIv2Endpoint + "/registries/alphanet/tokens/" + ID + `>; rel="successor-version"`},
+		{name: "v1", path: registryhttp.APIv1Endpoint + "/registries/alphanet/tokens/" + ID, wantLink: "<" + registryhttp.APIv2Endpoint + "/registries/alphanet/tokens/" + ID + `>; rel="successor-version"`},
+		{name: "v2", path: registryhttp.APIv2Endpoint + "/registries/alphanet/tokens/" + ID, wantV2: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			if deprecated := rec.Header().Get("Deprecation") == "true"; deprecated == test.wantV2 {
+				t.Errorf("Deprecation header set = %v for v2 = %v", deprecated, test.wantV2)
+			}
+			if got := rec.Header().Get("Link"); got != test.wantLink {
+				t.Errorf("Link = %s, want %s", got, test.wantLink)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if string(body["ID"]) != `"`+ID+`"` || string(body["name"]) != `"One"` {
+				t.Errorf("response lacks the token fields: %s", rec.Body)
+			}
+			for _, field := range []string{"issuerAlias", "verification", "trustLevel"} {
+				if _, ok := body[field]; ok != test.wantV2 {
+					t.Errorf("response has %s = %v for v2 = %v", field, ok, test.wantV2)
+				}
+			}
+			if !test.wantV2 {
+				return
+			}
+			token := &registryhttp.TokenV2{}
+			if err := json.Unmarshal(rec.Body.Bytes(), token); err != nil {
+				t.Fatal(err)
+			}
+			if token.IssuerAlias == nil || token.IssuerAlias.AliasID != "0x"+strings.Repeat("11", 32) || token.IssuerAlias.Address != "" {
+				t.Errorf("issuerAlias = %+v, want the alias without address", token.IssuerAlias)
+			}
+			if token.Verification == nil || token.Verification.Status != registryhttp.VerificationVerified {
+				t.Errorf("verification = %+v, want %s", token.Verification, registryhttp.VerificationVerified)
+			}
+			if token.Supply != nil {
+				t.Errorf("supply = %+v without a node", token.Supply)
+			}
+		})
+	}
+}
+
+func TestPublicProvenance(t *testing.T) {
+	tests := []struct {
+		name         string
+		registeredBy string
+		want         string
+	}{
+		{name: "IPv4", registeredBy: "192.0.2.77", want: "192.0.2.0/24"},
+		{name: "IPv6", registeredBy: "2001:db8:abcd:12::1", want: "2001:db8:abcd::/48"},
+		{name: "IPv4 mapped IPv6", registeredBy: "::ffff:192.0.2.77", want: "192.0.2.0/24"},
+		{name: "admin", registeredBy: "alice", want: "alice"},
+		{name: "API key", registeredBy: "alice/key:ci", want: "alice/key:ci"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provenance := &registry.Provenance{RegisteredBy: test.registeredBy, Node: "https://node.example.com", MilestoneIndex: 7}
+			got := publicProvenance(provenance)
+			if got.RegisteredBy != test.want {
+				t.Errorf("publicProvenance().RegisteredBy = %s, want %s", got.RegisteredBy, test.want)
+			}
+			if got.Node != provenance.Node || got.MilestoneIndex != provenance.MilestoneIndex {
+				t.Errorf("publicProvenance() = %+v, lost fields of %+v", got, provenance)
+			}
+			if provenance.RegisteredBy != test.registeredBy {
+				t.Errorf("publicProvenance() changed the stored provenance to %s", provenance.RegisteredBy)
+			}
+		})
+	}
+	if publicProvenance(nil) != nil {
+		t.Error("publicProvenance(nil) != nil")
+	}
+}
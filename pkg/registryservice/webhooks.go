@@ -0,0 +1,507 @@
+package registryservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhooksCollection   = "_webhooks"
+	deliveriesCollection = "_webhookDeliveries"
+
+	// webhookWorkers defines how many deliveries each instance attempts at the same time.
+	webhookWorkers = 4
+	// webhookPollInterval defines how often the queue is checked for due deliveries.
+	webhookPollInterval = 5 * time.Second
+	// webhookLeaseMargin defines how long a claimed delivery stays reserved beyond the webhook timeout, after which
+	// another instance retries it should the claiming one have crashed.
+	webhookLeaseMargin = 30 * time.Second
+	// webhookMinBackoff and webhookMaxBackoff bound the delay before the next attempt, which doubles on every failure.
+	webhookMinBackoff = 30 * time.Second
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookPruneInterval defines how often the finished deliveries beyond the retention are deleted.
+	webhookPruneInterval = time.Hour
+	// defaultDeliveryLimit and maxDeliveryLimit define how many deliveries are listed by default and at most.
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+func (s *Service) SaveWebhook(ctx context.Context, webhook *registry.Webhook) error {
+	_, err := s.db.Collection(webhooksCollection).InsertOne(ctx, webhook)
+	return errors.Wrap(err, "failed to insert webhook into mongo collection")
+}
+
+func (s *Service) LoadWebhook(ctx context.Context, ID string) (webhook *registry.Webhook, err error) {
+	// Query One
+	result := s.db.Collection(webhooksCollection).FindOne(ctx, bson.M{"_id": ID})
+	err = result.Decode(&webhook)
+	return
+}
+
+func (s *Service) LoadWebhooks(ctx context.Context) (webhooks []*registry.Webhook, err error) {
+	webhooks = make([]*registry.Webhook, 0)
+	cur, err := s.db.Collection(webhooksCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &webhooks)
+	return
+}
+
+// DeleteWebhook deletes a webhook together with its queued deliveries and delivery log.
+func (s *Service) DeleteWebhook(ctx context.Context, ID string) (err error) {
+	if _, err = s.db.Collection(deliveriesCollection).DeleteMany(ctx, bson.M{"webhookId": ID}); err != nil {
+		return
+	}
+	_, err = s.db.Collection(webhooksCollection).DeleteOne(ctx, bson.M{"_id": ID})
+	return
+}
+
+func (s *Service) SaveWebhookDeliveries(ctx context.Context, deliveries []*registry.WebhookDelivery) error {
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		documents[i] = delivery
+	}
+	_, err := s.db.Collection(deliveriesCollection).InsertMany(ctx, documents)
+	return errors.Wrap(err, "failed to insert webhook deliveries into mongo collection")
+}
+
+// ClaimWebhookDelivery reserves the pending delivery that has been due the longest for lease, so no other instance
+// attempts it meanwhile. It returns mongo.ErrNoDocuments if no delivery is due.
+func (s *Service) ClaimWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (delivery *registry.WebhookDelivery, err error) {
+	result := s.db.Collection(deliveriesCollection).FindOneAndUpdate(ctx,
+		bson.M{"status": registryhttp.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(lease), "leasedUntil": now.Add(lease)}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextAttemptAt": 1}).SetReturnDocument(options.After))
+	err = result.Decode(&delivery)
+	return
+}
+
+func (s *Service) UpdateWebhookDelivery(ctx context.Context, delivery *registry.WebhookDelivery) error {
+	_, err := s.db.Collection(deliveriesCollection).ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	return errors.Wrap(err, "failed to replace webhook delivery in mongo collection")
+}
+
+// RetryWebhookDelivery queues a delivery that was not delivered for an attempt at now. It returns
+// mongo.ErrNoDocuments if the delivery was delivered or an instance is attempting it.
+func (s *Service) RetryWebhookDelivery(ctx context.Context, ID string, now time.Time) (delivery *registry.WebhookDelivery, err error) {
+	result := s.db.Collection(deliveriesCollection).FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":    ID,
+			"status": bson.M{"$ne": registryhttp.DeliveryDelivered},
+			"$or":    bson.A{bson.M{"leasedUntil": bson.M{"$exists": false}}, bson.M{"leasedUntil": bson.M{"$lte": now}}},
+		},
+		bson.M{"$set": bson.M{"status": registryhttp.DeliveryPending, "nextAttemptAt": now}, "$unset": bson.M{"leasedUntil": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = result.Decode(&delivery)
+	return
+}
+
+func (s *Service) LoadWebhookDelivery(ctx context.Context, ID string) (delivery *registry.WebhookDelivery, err error) {
+	// Query One
+	result := s.db.Collection(deliveriesCollection).FindOne(ctx, bson.M{"_id": ID})
+	err = result.Decode(&delivery)
+	return
+}
+
+// LoadWebhookDeliveries loads the latest deliveries of a webhook, newest first, optionally only those with status.
+func (s *Service) LoadWebhookDeliveries(ctx context.Context, webhookID string, status string, limit int64) (deliveries []*registry.WebhookDelivery, err error) {
+	filter := bson.M{"webhookId": webhookID}
+	if status != "" {
+		filter["status"] = status
+	}
+	deliveries = make([]*registry.WebhookDelivery, 0)
+	cur, err := s.db.Collection(deliveriesCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(limit))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &deliveries)
+	return
+}
+
+// DeleteWebhookDeliveries deletes the delivered and failed deliveries queued before the given time.
+func (s *Service) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (err error) {
+	_, err = s.db.Collection(deliveriesCollection).DeleteMany(ctx, bson.M{"status": bson.M{"$ne": registryhttp.DeliveryPending}, "createdAt": bson.M{"$lt": before}})
+	return
+}
+
+// WebhookDispatcher posts the registry events to the webhooks subscribed to them. Deliveries are queued in MongoDB
+// and claimed by the dispatchers of all instances, failed attempts are retried with exponential backoff until
+// maxAttempts were made.
+type WebhookDispatcher struct {
+	webhooks    registry.WebhookService
+	client      *http.Client
+	timeout     time.Duration
+	maxAttempts int
+	retention   time.Duration
+	// wake makes the workers check the queue right away after deliveries were queued.
+	wake chan struct{}
+}
+
+// NewWebhookDispatcher creates a webhook dispatcher giving up on an attempt after timeout and keeping the finished
+// deliveries for retention. Webhooks at non-public addresses are refused unless allowPrivate is set.
+func NewWebhookDispatcher(webhooks registry.WebhookService, timeout time.Duration, maxAttempts int, retention time.Duration, allowPrivate bool) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer = publicDialer(timeout, "post webhook to")
+	}
+	return &WebhookDispatcher{
+		webhooks: webhooks,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				// a proxy would connect on our behalf and bypass the address check
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+			},
+			// a redirect counts as a failed attempt, the payload is signed for the configured url only
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		timeout:     timeout,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues the delivery of event to every webhook subscribed to it. It is registered with EventFeed.OnPublish,
+// a failure is logged only, as the change itself already happened.
+func (d *WebhookDispatcher) Enqueue(ctx context.Context, event *registry.Event) {
+	webhooks, err := d.webhooks.LoadWebhooks(ctx)
+	if err != nil {
+		ContextLogger(ctx).Warnw("Failed to load webhooks", "event", event.ID, "error", err)
+		return
+	}
+	now := time.Now().UTC()
+	var deliveries []*registry.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !subscribed(webhook.Networks, event.Network) || !subscribed(webhook.EventTypes, event.Type) {
+			continue
+		}
+		ID, err := randomString(12)
+		if err != nil {
+			ContextLogger(ctx).Warnw("Failed to queue webhook delivery", "webhook", webhook.ID, "event", event.ID, "error", err)
+			continue
+		}
+		deliveries = append(deliveries, &registry.WebhookDelivery{
+			ID:            ID,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Status:        registryhttp.DeliveryPending,
+			Attempts:      make([]*registry.DeliveryAttempt, 0),
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := d.webhooks.SaveWebhookDeliveries(ctx, deliveries); err != nil {
+		ContextLogger(ctx).Warnw("Failed to queue webhook deliveries", "event", event.ID, "error", err)
+		return
+	}
+	d.Wake()
+}
+
+// Wake makes the workers check the queue right away.
+func (d *WebhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run attempts the due deliveries and prunes the finished ones until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for i := 0; i < webhookWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			d.work(ctx)
+		}()
+	}
+	defer workers.Wait()
+
+	prune := time.NewTicker(webhookPruneInterval)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-prune.C:
+			if err := d.webhooks.DeleteWebhookDeliveries(ctx, now.Add(-d.retention)); err != nil {
+				ContextLogger(ctx).Warnw("Failed to prune webhook deliveries", "error", err)
+			}
+		}
+	}
+}
+
+// work attempts due deliveries one after the other and waits for more once the queue has none.
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		delivery, err := d.webhooks.ClaimWebhookDelivery(ctx, time.Now().UTC(), d.timeout+webhookLeaseMargin)
+		switch {
+		case err == nil:
+			d.attempt(ctx, delivery)
+			continue
+		case !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil:
+			ContextLogger(ctx).Warnw("Failed to claim webhook delivery", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// attempt posts a delivery to its webhook and records the outcome, scheduling the next attempt if it failed.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *registry.WebhookDelivery) {
+	start := time.Now().UTC()
+	attempt := &registry.DeliveryAttempt{Time: start}
+	webhook, err := d.webhooks.LoadWebhook(ctx, delivery.WebhookID)
+	if err == nil {
+		attempt.StatusCode, err = d.post(ctx, webhook, delivery)
+	}
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.LeasedUntil = time.Time{}
+
+	switch {
+	case err == nil:
+		delivery.Status = registryhttp.DeliveryDelivered
+	case len(delivery.Attempts) >= d.maxAttempts:
+		attempt.Error = err.Error()
+		delivery.Status = registryhttp.DeliveryFailed
+	default:
+		attempt.Error = err.Error()
+		delivery.NextAttemptAt = start.Add(webhookBackoff(len(delivery.Attempts)))
+	}
+	ContextLogger(ctx).Debugw("Attempted webhook delivery", "webhook", delivery.WebhookID, "delivery", delivery.ID, "status", delivery.Status, "error", attempt.Error)
+	if err := d.webhooks.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		ContextLogger(ctx).Warnw("Failed to record webhook delivery", "delivery", delivery.ID, "error", err)
+	}
+}
+
+// post sends the signed payload of a delivery and returns the status the webhook responded with. Any status but 2xx
+// fails the attempt.
+func (d *WebhookDispatcher) post(ctx context.Context, webhook *registry.Webhook, delivery *registry.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(&registryhttp.WebhookPayload{DeliveryID: delivery.ID, WebhookID: webhook.ID, Event: delivery.Event})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode payload")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "token-verifier-webhooks")
+	req.Header.Set(registryhttp.WebhookEventHeader, delivery.Event.Type)
+	req.Header.Set(registryhttp.WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(registryhttp.WebhookSignatureHeader, registryhttp.WebhookSignature(webhook.Secret, time.Now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Newf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff returns the delay before the attempt following the given number of failed ones.
+func webhookBackoff(failed int) time.Duration {
+	backoff := webhookMinBackoff
+	for i := 1; i < failed && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// subscribed tells whether value is one of the subscribed values, an empty subscription includes every value.
+func subscribed(subscription []string, value string) bool {
+	if len(subscription) == 0 {
+		return true
+	}
+	for _, s := range subscription {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookHTTPHandler serves the management of webhooks and their delivery logs.
+type WebhookHTTPHandler struct {
+	webhooks   registry.WebhookService
+	dispatcher *WebhookDispatcher
+	auditor    *Auditor
+}
+
+func NewWebhookHTTPHandler(webhooks registry.WebhookService, dispatcher *WebhookDispatcher, auditor *Auditor) *WebhookHTTPHandler {
+	return &WebhookHTTPHandler{webhooks: webhooks, dispatcher: dispatcher, auditor: auditor}
+}
+
+func (h *WebhookHTTPHandler) LoadWebhooks(c echo.Context) error {
+	webhooks, err := h.webhooks.LoadWebhooks(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load webhooks")))
+	}
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook creates a webhook with a random signing secret, which is returned only once.
+func (h *WebhookHTTPHandler) CreateWebhook(c echo.Context) error {
+	var req *registryhttp.CreateWebhookRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Wrap(err, "failed to parse request body as JSON into a webhook")))
+	}
+	if err := validateWebhook(req); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse(c, err))
+	}
+	ID, err := randomString(8)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, err))
+	}
+	webhook := &registry.Webhook{
+		ID:         ID,
+		URL:        req.URL,
+		Secret:     secret,
+		Networks:   req.Networks,
+		EventTypes: req.EventTypes,
+		CreatedAt:  time.Now().UTC(),
+		CreatedBy:  AdminIdentity(c).String(),
+	}
+	if webhook.Networks == nil {
+		webhook.Networks = make([]string, 0)
+	}
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = make([]string, 0)
+	}
+	if err := h.webhooks.SaveWebhook(c.Request().Context(), webhook); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to save webhook")))
+	}
+	h.auditor.Record(c, "createWebhook", "", webhook.ID)
+	return c.JSON(http.StatusCreated, &registryhttp.CreateWebhookResponse{Secret: secret, Webhook: webhook})
+}
+
+func (h *WebhookHTTPHandler) DeleteWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	ID := c.Param("webhookID")
+	if _, err := h.webhooks.LoadWebhook(ctx, ID); err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load webhook")))
+	}
+	if err := h.webhooks.DeleteWebhook(ctx, ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to delete webhook")))
+	}
+	h.auditor.Record(c, "deleteWebhook", "", ID)
+	return c.JSON(http.StatusOK, nil)
+}
+
+// LoadWebhookDeliveries returns the latest deliveries of a webhook with their attempts, newest first. The status
+// query parameter selects pending, delivered or failed deliveries only.
+func (h *WebhookHTTPHandler) LoadWebhookDeliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+	ID := c.Param("webhookID")
+	status := c.QueryParam("status")
+	switch status {
+	case "", registryhttp.DeliveryPending, registryhttp.DeliveryDelivered, registryhttp.DeliveryFailed:
+	default:
+		return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("invalid status %q, must be pending, delivered or failed", status)))
+	}
+	limit := int64(defaultDeliveryLimit)
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || parsed <= 0 || parsed > maxDeliveryLimit {
+			return c.JSON(http.StatusBadRequest, errorResponse(c, errors.Newf("limit must be between 1 and %d", maxDeliveryLimit)))
+		}
+		limit = parsed
+	}
+	if _, err := h.webhooks.LoadWebhook(ctx, ID); err != nil {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.Wrap(err, "service failed to load webhook")))
+	}
+	deliveries, err := h.webhooks.LoadWebhookDeliveries(ctx, ID, status, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to load webhook deliveries")))
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryWebhookDelivery queues a delivery for another attempt right away. A delivery that ran out of attempts gets a
+// single one more, a delivery an instance is attempting can not be retried until the attempt finished.
+func (h *WebhookHTTPHandler) RetryWebhookDelivery(c echo.Context) error {
+	ctx := c.Request().Context()
+	delivery, err := h.webhooks.LoadWebhookDelivery(ctx, c.Param("deliveryID"))
+	if err != nil || delivery.WebhookID != c.Param("webhookID") {
+		return c.JSON(http.StatusNotFound, errorResponse(c, errors.New("webhook delivery not found")))
+	}
+	if delivery.Status == registryhttp.DeliveryDelivered {
+		return c.JSON(http.StatusConflict, errorResponse(c, errors.New("webhook delivery was delivered already")))
+	}
+	// the delivery is updated only if it is not claimed, or it would be attempted twice
+	delivery, err = h.webhooks.RetryWebhookDelivery(ctx, delivery.ID, time.Now().UTC())
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.JSON(http.StatusConflict, errorResponse(c, errors.New("webhook delivery is being attempted or was delivered already")))
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, errorResponse(c, errors.Wrap(err, "service failed to update webhook delivery")))
+	}
+	h.dispatcher.Wake()
+	h.auditor.Record(c, "retryWebhookDelivery", "", delivery.ID)
+	return c.JSON(http.StatusOK, delivery)
+}
+
+func validateWebhook(req *registryhttp.CreateWebhookRequest) error {
+	u, err := url.ParseRequestURI(req.URL)
+	if err != nil || u.Host == "" {
+		return errors.Newf("invalid webhook url %q", req.URL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Newf("unsupported webhook url scheme %q", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("webhook url must not contain credentials, verify the signature instead")
+	}
+	for _, network := range req.Networks {
+		if !validNetworkName(network) {
+			return errors.Newf("invalid network name %q", network)
+		}
+	}
+	for _, eventType := range req.EventTypes {
+		if !subscribed(registryhttp.EventTypes, eventType) || eventType == "" {
+			return errors.Newf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package registryservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubDeliveries holds a single webhook delivery, any call it does not implement panics.
+type stubDeliveries struct {
+	registry.WebhookService
+	delivery *registry.WebhookDelivery
+	retried  bool
+}
+
+func (s *stubDeliveries) LoadWebhookDelivery(context.Context, string) (*registry.WebhookDelivery, error) {
+	found := *s.delivery
+	return &found, nil
+}
+
+func (s *stubDeliveries) RetryWebhookDelivery(_ context.Context, _ string, now time.Time) (*registry.WebhookDelivery, error) {
+	if s.delivery.Status == registryhttp.DeliveryDelivered || s.delivery.LeasedUntil.After(now) {
+		return nil, mongo.ErrNoDocuments
+	}
+	s.retried = true
+	s.delivery.Status = registryhttp.DeliveryPending
+	s.delivery.NextAttemptAt = now
+	return s.delivery, nil
+}
+
+// stubAudit accepts every audit entry, any other call panics.
+type stubAudit struct {
+	registry.AdminService
+}
+
+func (stubAudit) SaveAuditEntry(context.Context, *registry.AuditEntry) error {
+	return nil
+}
+
+func TestRetryWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name       string
+		delivery   *registry.WebhookDelivery
+		wantStatus int
+	}{
+		{name: "failed", delivery: &registry.WebhookDelivery{Status: registryhttp.DeliveryFailed}, wantStatus: http.StatusOK},
+		{name: "pending", delivery: &registry.WebhookDelivery{Status: registryhttp.DeliveryPending, NextAttemptAt: time.Now().Add(time.Hour)}, wantStatus: http.StatusOK},
+		{name: "lease expired", delivery: &registry.WebhookDelivery{Status: registryhttp.DeliveryPending, LeasedUntil: time.Now().Add(-time.Minute)}, wantStatus: http.StatusOK},
+		{name: "being attempted", delivery: &registry.WebhookDelivery{Status: registryhttp.DeliveryPending, LeasedUntil: time.Now().Add(time.Minute)}, wantStatus: http.StatusConflict},
+		{name: "delivered", delivery: &registry.WebhookDelivery{Status: registryhttp.DeliveryDelivered}, wantStatus: http.StatusConflict},
+		{name: "delivery of another webhook", delivery: &registry.WebhookDelivery{WebhookID: "other", Status: registryhttp.DeliveryFailed}, wantStatus: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.delivery.WebhookID == "" {
+				test.delivery.WebhookID = "hook"
+			}
+			test.delivery.ID = "delivery"
+			webhooks := &stubDeliveries{delivery: test.delivery}
+			h := NewWebhookHTTPHandler(webhooks, NewWebhookDispatcher(webhooks, time.Second, 1, time.Hour, false), NewAuditor(stubAudit{}))
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+			c.SetParamNames("webhookID", "deliveryID")
+			c.SetParamValues("hook", "delivery")
+			if err := h.RetryWebhookDelivery(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			if webhooks.retried != (test.wantStatus == http.StatusOK) {
+				t.Errorf("delivery retried = %v, want %v", webhooks.retried, test.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
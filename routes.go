@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// publicRoutes registers the public registry routes, which every API version shares.
+type publicRoutes struct {
+	handler   *registryservice.HTTPHandler
+	snapshots *registryservice.SnapshotHTTPHandler
+	events    *registryservice.EventFeed
+	// limited applies the rate limits, bodyLimit and verifications guard the routes that verify tokens,
+	// supplyReads caps the token reads querying the supply, eventStreams caps the open event streams and reports
+	// limits the abuse reports.
+	limited       echo.MiddlewareFunc
+	bodyLimit     echo.MiddlewareFunc
+	verifications echo.MiddlewareFunc
+	supplyReads   echo.MiddlewareFunc
+	eventStreams  echo.MiddlewareFunc
+	reports       echo.MiddlewareFunc
+}
+
+func (p *publicRoutes) register(g *echo.Group, version int) {
+	v := registryservice.APIVersion(version)
+	g.POST("/registries/:network/tokens", p.handler.SaveToken, v, p.limited, p.bodyLimit, p.verifications)
+	g.POST("/registries/:network/tokens/validate", p.handler.ValidateToken, v, p.limited, p.bodyLimit, p.verifications)
+	g.GET("/registries/:network/tokens", p.handler.LoadTokens, v, p.limited)
+	if version == registryservice.APIv2 {
+		g.GET("/registries/:network/tokens/:ID", p.handler.LoadToken, v, p.limited, p.supplyReads)
+	} else {
+		g.GET("/registries/:network/tokens/:ID", p.handler.LoadToken, v, p.limited)
+	}
+	g.GET("/registries/:network/tokens/:ID/logo", p.handler.LoadLogo, v, p.limited)
+	g.GET("/registries/:network/tokenlist.json", p.handler.LoadTokenList, v, p.limited)
+	g.GET("/registries/:network/snapshots/latest", p.snapshots.LoadLatestSnapshot, v, p.limited)
+	g.GET("/registries/:network/snapshots/:sequence", p.snapshots.LoadSnapshot, v, p.limited)
+	g.GET("/registries/:network/root", p.snapshots.LoadRoot, v, p.limited)
+	g.GET("/registries/:network/tokens/:ID/proof", p.snapshots.LoadProof, v, p.limited)
+	g.POST("/registries/:network/tokens/:ID/reports", p.handler.ReportToken, v, p.limited, p.reports, p.bodyLimit)
+	g.GET("/registries/:network/events", p.events.StreamEvents, v, p.limited, p.eventStreams)
+	g.GET("/registries", p.handler.LoadNetworks, v, p.limited)
+	g.GET("/logos/:hash", p.handler.LoadPinnedLogo, v, p.limited)
+}
+
+// serverRoutes registers every route of the server.
+type serverRoutes struct {
+	public   *publicRoutes
+	verifier *registryservice.Verifier
+	admins   *registryservice.AdminHTTPHandler
+	webhooks *registryservice.WebhookHTTPHandler
+	// adminLimited limits the admin clients before auth authenticates them.
+	adminLimited echo.MiddlewareFunc
+	auth         echo.MiddlewareFunc
+}
+
+func (r *serverRoutes) register(e *echo.Echo) {
+	e.GET("/", IndexRequest)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/health/live", LivenessRequest)
+	e.GET("/health/ready", ReadinessRequest(func() error { return pingMongoDB(clientDB) }, r.verifier))
+	e.GET(registryhttp.OpenAPIEndpoint, OpenAPIRequest)
+	e.GET(registryhttp.DocsEndpoint, DocsRequest)
+
+	// v1 keeps the original token schema, it is also served at the unversioned paths of the first release
+	r.public.register(e.Group(""), registryservice.APIv1)
+	r.public.register(e.Group(registryhttp.APIv1Endpoint), registryservice.APIv1)
+	r.public.register(e.Group(registryhttp.APIv2Endpoint), registryservice.APIv2)
+
+	// every route under /admin requires credentials, the group also rejects unknown admin paths without them
+	admin := e.Group(registryhttp.AdminEndpoint, r.adminLimited, r.auth)
+	admin.DELETE("/:network/tokens/byID/:ID", r.public.handler.DeleteTokensByID, registryservice.RequireScope(registryservice.ScopeTokensDelete))
+	admin.DELETE("/:network/tokens/byName/:name", r.public.handler.DeleteTokensByName, registryservice.RequireScope(registryservice.ScopeTokensDelete))
+	admin.GET("/:network/tokens/export", r.public.handler.ExportTokens, registryservice.RequireScope(registryservice.ScopeTokensExport))
+	admin.POST("/:network/tokens/import", r.public.handler.ImportTokens, registryservice.RequireScope(registryservice.ScopeTokensImport))
+	admin.POST("/:network/tokens/byID/:ID/trust", r.public.handler.SetTrustLevel, registryservice.RequireScope(registryservice.ScopeTrustAdmin))
+	admin.GET("/:network/issuers", r.public.handler.LoadVerifiedIssuers, registryservice.RequireScope(registryservice.ScopeTrustAdmin))
+	admin.POST("/:network/issuers/:aliasID", r.public.handler.VerifyIssuer, registryservice.RequireScope(registryservice.ScopeTrustAdmin))
+	admin.DELETE("/:network/issuers/:aliasID", r.public.handler.UnverifyIssuer, registryservice.RequireScope(registryservice.ScopeTrustAdmin))
+	admin.POST("/filters/:word", r.public.handler.AddFilter, registryservice.RequireScope(registryservice.ScopeFiltersWrite))
+	admin.DELETE("/filters/:word", r.public.handler.DeleteFilter, registryservice.RequireScope(registryservice.ScopeFiltersWrite))
+	admin.GET("/filters", r.public.handler.LoadFilter, registryservice.RequireScope(registryservice.ScopeFiltersRead))
+	admin.POST("/networks/:network", r.public.handler.EnableNetwork, registryservice.RequireScope(registryservice.ScopeNetworksAdmin))
+	admin.DELETE("/networks/:network", r.public.handler.DisableNetwork, registryservice.RequireScope(registryservice.ScopeNetworksAdmin))
+	admin.GET("/whoami", r.admins.WhoAmI)
+	admin.GET("/admins", r.admins.LoadAdmins, registryservice.RequireScope(registryservice.ScopeAdminsAdmin))
+	admin.POST("/admins", r.admins.CreateAdmin, registryservice.RequireScope(registryservice.ScopeAdminsAdmin))
+	admin.DELETE("/admins/:name", r.admins.DeleteAdmin, registryservice.RequireScope(registryservice.ScopeAdminsAdmin))
+	admin.GET("/keys", r.admins.LoadAPIKeys)
+	admin.POST("/keys", r.admins.CreateAPIKey)
+	admin.DELETE("/keys/:keyID", r.admins.DeleteAPIKey)
+	admin.GET("/audit", r.admins.LoadAuditEntries, registryservice.RequireScope(registryservice.ScopeAdminsAdmin))
+	admin.GET("/reports", r.public.handler.LoadReports, registryservice.RequireScope(registryservice.ScopeReportsAdmin))
+	admin.GET("/reports/:reportID", r.public.handler.LoadReport, registryservice.RequireScope(registryservice.ScopeReportsAdmin))
+	admin.POST("/reports/:reportID/resolve", r.public.handler.ResolveReport, registryservice.RequireScope(registryservice.ScopeReportsAdmin))
+	admin.POST("/reports/:reportID/dismiss", r.public.handler.DismissReport, registryservice.RequireScope(registryservice.ScopeReportsAdmin))
+	admin.GET("/webhooks", r.webhooks.LoadWebhooks, registryservice.RequireScope(registryservice.ScopeWebhooksAdmin))
+	admin.POST("/webhooks", r.webhooks.CreateWebhook, registryservice.RequireScope(registryservice.ScopeWebhooksAdmin))
+	admin.DELETE("/webhooks/:webhookID", r.webhooks.DeleteWebhook, registryservice.RequireScope(registryservice.ScopeWebhooksAdmin))
+	admin.GET("/webhooks/:webhookID/deliveries", r.webhooks.LoadWebhookDeliveries, registryservice.RequireScope(registryservice.ScopeWebhooksAdmin))
+	admin.POST("/webhooks/:webhookID/deliveries/:deliveryID/retry", r.webhooks.RetryWebhookDelivery, registryservice.RequireScope(registryservice.ScopeWebhooksAdmin))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubAdmins knows no admins and API keys, any other call panics.
+type stubAdmins struct {
+	registry.AdminService
+}
+
+func (stubAdmins) LoadAdmin(context.Context, string) (*registry.Admin, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+func (stubAdmins) LoadAPIKey(context.Context, string) (*registry.APIKey, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+// testServer registers the routes of the server with handlers that must not be reached.
+func testServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	e := echo.New()
+	unlimited := registryservice.NewRateLimiter(1000, 1000, 0, 0, false).Middleware()
+	routes := &serverRoutes{
+		public: &publicRoutes{
+			handler:       &registryservice.HTTPHandler{},
+			snapshots:     &registryservice.SnapshotHTTPHandler{},
+			events:        &registryservice.EventFeed{},
+			limited:       unlimited,
+			bodyLimit:     registryservice.BodyLimit(1024),
+			verifications: registryservice.ConcurrencyLimit(registryservice.LimitVerifications, 1),
+			supplyReads:   registryservice.ConcurrencyLimit(registryservice.LimitSupplyReads, 1),
+			eventStreams:  registryservice.ConcurrencyLimit(registryservice.LimitEventStreams, 1),
+			reports:       unlimited,
+		},
+		admins:       &registryservice.AdminHTTPHandler{},
+		webhooks:     &registryservice.WebhookHTTPHandler{},
+		adminLimited: unlimited,
+		auth:         registryservice.NewAuthenticator(stubAdmins{}, "admin", "").Middleware(),
+	}
+	routes.register(e)
+	return e
+}
+
+// TestAdminRoutesRequireCredentials sends requests without valid credentials to every admin route, which guards
+// against admin routes registered outside the admin group.
+func TestAdminRoutesRequireCredentials(t *testing.T) {
+	e := testServer(t)
+	credentials := map[string]func(req *http.Request){
+		"none":          func(req *http.Request) {},
+		"unknown key":   func(req *http.Request) { req.Header.Set("X-API-Key", "tvk_unknown_secret") },
+		"malformed key": func(req *http.Request) { req.Header.Set(echo.HeaderAuthorization, "Bearer secret") },
+	}
+	checked := 0
+	for _, route := range e.Routes() {
+		if route.Path != registryhttp.AdminEndpoint && !strings.HasPrefix(route.Path, registryhttp.AdminEndpoint+"/") {
+			continue
+		}
+		path := routeExample(route.Path)
+		// skip routes the example path does not resolve to, e.g. the group's catch-all for a path matching another route
+		c := e.NewContext(nil, nil)
+		e.Router().Find(route.Method, path, c)
+		if c.Path() != route.Path {
+			continue
+		}
+		checked++
+		for name, setCredentials := range credentials {
+			req := httptest.NewRequest(route.Method, path, nil)
+			setCredentials(req)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with %s credentials returned %d, want %d", route.Method, route.Path, name, rec.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no admin routes registered")
+	}
+}
+
+// routeExample fills the parameters of a route path with example values.
+func routeExample(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || segment == "*" {
+			segments[i] = "example"
+		}
+	}
+	return strings.Join(segments, "/")
+}
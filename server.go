@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+	"github.com/lzpap/token-verifier/pkg/registryservice"
 )
 
 // IndexRequest returns INDEX
@@ -18,47 +21,77 @@ func IndexRequest(c echo.Context) error {
 func Server() *echo.Echo {
 	serverOnce.Do(func() {
 		server = echo.New()
+		server.Use(registryservice.RequestIDMiddleware(log))
+		server.Use(registryservice.AccessLogMiddleware(*trustProxyHeaders))
+		server.Use(registryservice.MetricsMiddleware())
 		server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-			Skipper:      middleware.DefaultSkipper,
-			AllowOrigins: []string{"*"},
-			AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
+			Skipper:      isAdminRequest,
+			AllowOrigins: splitList(*corsAllowOrigins),
+			AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost},
 		}))
+		// without allowed origins, browsers may not call the admin routes from other origins
+		if adminOrigins := splitList(*adminCORSAllowOrigins); len(adminOrigins) > 0 {
+			server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+				Skipper:      func(c echo.Context) bool { return !isAdminRequest(c) },
+				AllowOrigins: adminOrigins,
+				AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+				AllowHeaders: []string{echo.HeaderAuthorization, echo.HeaderContentType, "X-API-Key"},
+			}))
+		}
 
-		server.HTTPErrorHandler = func(err error, c echo.Context) {
-			log.Warnf("Request failed: %s", err)
+		server.HTTPErrorHandler = httpErrorHandler
+	})
+	return server
+}
 
-			var statusCode int
-			var message string
+// httpErrorHandler responds to the errors handlers return with an error response. Echo errors keep their status code,
+// any other error is an internal server error.
+func httpErrorHandler(err error, c echo.Context) {
+	registryservice.Logger(c).Warnw("Request failed", "error", err)
 
-			switch errors.Unwrap(err) {
-			case echo.ErrUnauthorized:
-				statusCode = http.StatusUnauthorized
-				message = "unauthorized"
+	var statusCode int
+	var message string
 
-			case echo.ErrForbidden:
-				statusCode = http.StatusForbidden
-				message = "access forbidden"
+	// match the echo errors by status code, as they may be returned wrapped or with another message
+	var httpErr *echo.HTTPError
+	code := 0
+	if errors.As(err, &httpErr) {
+		code = httpErr.Code
+	}
 
-			case echo.ErrInternalServerError:
-				statusCode = http.StatusInternalServerError
-				message = "internal server error"
+	switch code {
+	case http.StatusUnauthorized:
+		statusCode = http.StatusUnauthorized
+		message = "unauthorized"
 
-			case echo.ErrNotFound:
-				statusCode = http.StatusNotFound
-				message = "not found"
+	case http.StatusForbidden:
+		statusCode = http.StatusForbidden
+		message = "access forbidden"
 
-			case echo.ErrBadRequest:
-				statusCode = http.StatusBadRequest
-				message = "bad request"
+	case http.StatusInternalServerError, 0:
+		statusCode = http.StatusInternalServerError
+		message = "internal server error"
 
-			default:
-				statusCode = http.StatusInternalServerError
-				message = "internal server error"
-			}
+	case http.StatusNotFound:
+		statusCode = http.StatusNotFound
+		message = "not found"
 
-			message = fmt.Sprintf("%s, error: %+v", message, err)
-			c.String(statusCode, message)
-		}
-	})
-	return server
+	case http.StatusBadRequest:
+		statusCode = http.StatusBadRequest
+		message = "bad request"
+
+	default:
+		statusCode = code
+		message = fmt.Sprint(httpErr.Message)
+	}
+
+	message = fmt.Sprintf("%s, error: %+v", message, err)
+	c.JSON(statusCode, &registryhttp.ErrorResponse{Error: message, RequestID: registryservice.RequestID(c)})
+}
+
+// isAdminRequest tells whether the request targets the admin routes. It matches the request path, as preflight
+// requests do not match a route.
+func isAdminRequest(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == registryhttp.AdminEndpoint || strings.HasPrefix(path, registryhttp.AdminEndpoint+"/")
 }
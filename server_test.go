@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo"
+	"github.com/lzpap/token-verifier/pkg/registry/registryhttp"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		err        error
+		wantStatus int
+	}{
+		{name: "method not allowed", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+		{name: "too many requests", method: http.MethodGet, err: echo.NewHTTPError(http.StatusTooManyRequests), wantStatus: http.StatusTooManyRequests},
+		{name: "request entity too large", method: http.MethodGet, err: echo.ErrStatusRequestEntityTooLarge, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "wrapped not found", method: http.MethodGet, err: errors.Wrap(echo.ErrNotFound, "token"), wantStatus: http.StatusNotFound},
+		{name: "service unavailable", method: http.MethodGet, err: echo.NewHTTPError(http.StatusServiceUnavailable), wantStatus: http.StatusServiceUnavailable},
+		{name: "other error", method: http.MethodGet, err: errors.New("failed"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = httpErrorHandler
+			e.GET("/", func(c echo.Context) error { return test.err })
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(test.method, "/", nil))
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			response := &registryhttp.ErrorResponse{}
+			if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil || response.Error == "" {
+				t.Errorf("body %s is not an error response", rec.Body)
+			}
+			if test.wantStatus != http.StatusInternalServerError && strings.HasPrefix(response.Error, "internal server error") {
+				t.Errorf("error %q hides the status", response.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// workers tracks the background workers that shutdown waits for.
+var workers sync.WaitGroup
+
+// runWorker runs worker in the background until ctx is cancelled. Workers must return once ctx is done.
+func runWorker(ctx context.Context, name string, worker func(ctx context.Context)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		log.Infof("Starting %s ...", name)
+		worker(ctx)
+		log.Infof("Stopped %s", name)
+	}()
+}
+
+// shutdown stops accepting requests, waits for in-flight handlers and background workers until the shutdown
+// timeout expires and disconnects from MongoDB.
+func shutdown() {
+	log.Infof("Shutting down ...")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Server shutdown failed: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("Background workers did not stop within %s", *shutdownTimeout)
+	}
+
+	disconnectMongoDB(clientDB)
+	log.Infof("Shutdown complete")
+}
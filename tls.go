@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// tlsVersions maps the supported values of tlsMinVersion to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// startServer serves plain HTTP, or HTTPS and optionally HTTP redirecting to it if TLS is configured.
+// stop is called if a server fails.
+func startServer(ctx context.Context, stop func()) error {
+	if *httpsBindAddr == "" {
+		serve("HTTP", server.Server, *httpBindAddr, server, stop)
+		return nil
+	}
+
+	certificates, err := newCertReloader(*tlsCertFile, *tlsKeyFile)
+	if err != nil {
+		return err
+	}
+	runWorker(ctx, "certificate reloader", certificates.Run)
+	server.TLSServer.TLSConfig = &tls.Config{
+		MinVersion:     tlsVersions[*tlsMinVersion],
+		GetCertificate: certificates.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	serve("HTTPS", server.TLSServer, *httpsBindAddr, server, stop)
+
+	if *httpBindAddr != "" {
+		var handler http.Handler = server
+		if *httpRedirect {
+			handler = redirectToHTTPS(*httpsBindAddr)
+		}
+		serve("HTTP", server.Server, *httpBindAddr, handler, stop)
+	}
+	return nil
+}
+
+func serve(name string, s *http.Server, addr string, handler http.Handler, stop func()) {
+	s.Addr = addr
+	s.Handler = handler
+	go func() {
+		var err error
+		if s.TLSConfig != nil {
+			// the certificate is provided by TLSConfig.GetCertificate
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("%s server failed: %s", name, err)
+			stop()
+		}
+	}()
+	log.Infof("Serving %s on %s", name, addr)
+}
+
+// redirectToHTTPS redirects requests to the HTTPS server at httpsAddr. Health checks are served on HTTP as well,
+// so probes keep working without TLS.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/health/") {
+			server.ServeHTTP(w, req)
+			return
+		}
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + req.URL.RequestURI()
+		http.Redirect(w, req, target, http.StatusPermanentRedirect)
+	})
+}
+
+// certReloader serves a certificate and reloads it when the certificate or key file changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.certificate, nil
+}
+
+// Run checks the files for changes every tlsReloadInterval until ctx is done. A certificate that fails to load is
+// logged and the previous one kept.
+func (r *certReloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(*tlsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.Warnf("Failed to reload TLS certificate: %s", err)
+			} else if reloaded {
+				log.Infof("Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+}
+
+// reload loads the certificate if a file was modified since it was last loaded.
+func (r *certReloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mutex.RLock()
+	unchanged := r.certificate != nil && !modTime.After(r.modTime)
+	r.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to load TLS certificate")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.certificate = &certificate
+	r.modTime = modTime
+	return true, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to stat TLS file")
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
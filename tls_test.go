@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, "first", modTime)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		change       func()
+		wantReloaded bool
+		wantErr      bool
+		wantName     string
+	}{
+		{name: "unchanged", change: func() {}, wantName: "first"},
+		{name: "renewed", change: func() {
+			modTime = modTime.Add(time.Minute)
+			writeCertificate(t, certFile, keyFile, "second", modTime)
+		}, wantReloaded: true, wantName: "second"},
+		{name: "invalid certificate", change: func() {
+			modTime = modTime.Add(time.Minute)
+			writeFile(t, certFile, []byte("not a certificate"), modTime)
+		}, wantErr: true, wantName: "second"},
+		{name: "missing key", change: func() { os.Remove(keyFile) }, wantErr: true, wantName: "second"},
+		{name: "restored", change: func() {
+			modTime = modTime.Add(time.Minute)
+			writeCertificate(t, certFile, keyFile, "third", modTime)
+		}, wantReloaded: true, wantName: "third"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.change()
+			reloaded, err := reloader.reload()
+			if (err != nil) != test.wantErr || reloaded != test.wantReloaded {
+				t.Errorf("reload() = %v, %v, want %v and error %v", reloaded, err, test.wantReloaded, test.wantErr)
+			}
+			certificate, err := reloader.GetCertificate(nil)
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaf.Subject.CommonName != test.wantName {
+				t.Errorf("serving certificate %s, want %s", leaf.Subject.CommonName, test.wantName)
+			}
+		})
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Error("newCertReloader() succeeded without certificate files")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		target    string
+		want      string
+	}{
+		{name: "default port", httpsAddr: ":443", target: "http://registry.example.com/api/v2/registries?x=1", want: "https://registry.example.com/api/v2/registries?x=1"},
+		{name: "custom port", httpsAddr: "0.0.0.0:8443", target: "http://registry.example.com:8080/tokens", want: "https://registry.example.com:8443/tokens"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(test.httpsAddr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+			if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != test.want {
+				t.Errorf("redirect = %d to %s, want %d to %s", rec.Code, rec.Header().Get("Location"), http.StatusPermanentRedirect, test.want)
+			}
+		})
+	}
+}
+
+// writeCertificate writes a self-signed certificate for name and its key, both modified at modTime.
+func writeCertificate(t *testing.T, certFile string, keyFile string, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cert, keyPEM bytes.Buffer
+	pem.Encode(&cert, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(&keyPEM, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	writeFile(t, certFile, cert.Bytes(), modTime)
+	writeFile(t, keyFile, keyPEM.Bytes(), modTime)
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}